@@ -162,6 +162,11 @@ func rateAuthorNode(c candidate, contentNodes []*html.Node, cruftBlocks []*html.
 		c.addPoints(1, "indicative text")
 	}
 
+	// TEST: photo credit? ("Photograph: ..." etc)
+	if _, credit := splitCredit(c.txt()); credit != "" {
+		c.addPoints(-3, "looks like photo credit")
+	}
+
 	// TODO:
 	//  test: penalise for full sentence text (eg punctuation)
 	//  test: penalise for stopwords ("about" etc)
@@ -230,6 +235,9 @@ func grabAuthors(root *html.Node, contentNodes []*html.Node, headlineNode *html.
 			authorC.addPoints(-3, "very verbose")
 		} else if len(txt) < 3 {
 			earlyOut = true
+		} else if insideCaption(el) {
+			// image captions and photo credits are not bylines
+			earlyOut = true
 		} else {
 			// inside comment?
 			// if so, just ignore.
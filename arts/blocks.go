@@ -0,0 +1,275 @@
+package arts
+
+// blocks.go - splitting the extracted content up into a list of blocks
+// (paragraphs, headings, lists etc), each with a stable id, so that
+// different versions of an article can be compared paragraph by paragraph.
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"strings"
+)
+
+// BlockKind is the type of a content block
+type BlockKind string
+
+const (
+	BlockParagraph BlockKind = "paragraph"
+	BlockHeading   BlockKind = "heading"
+	BlockList      BlockKind = "list"
+	BlockQuote     BlockKind = "quote"
+	BlockFigure    BlockKind = "figure"
+	BlockTable     BlockKind = "table"
+	BlockEmbed     BlockKind = "embed"
+)
+
+// Block is a single chunk of the article content
+type Block struct {
+	// ID is a hash of the kind and text (plus urls, for images and embeds),
+	// so it'll be the same for an unchanged block in a later version of the
+	// article. Repeated blocks get a "-2", "-3"... suffix.
+	ID   string    `json:"id"`
+	Kind BlockKind `json:"kind"`
+	// Level is the heading level (1-6), for headings
+	Level int `json:"level,omitempty"`
+	// Text is the plain text of the block. List items and table rows are
+	// separated by newlines, paragraphs within quotes by blank lines.
+	Text string `json:"text"`
+	// HTML is the block's markup (including any inline formatting)
+	HTML string `json:"html"`
+}
+
+var blockKinds = map[atom.Atom]BlockKind{
+	atom.P:          BlockParagraph,
+	atom.Pre:        BlockParagraph,
+	atom.Address:    BlockParagraph,
+	atom.H1:         BlockHeading,
+	atom.H2:         BlockHeading,
+	atom.H3:         BlockHeading,
+	atom.H4:         BlockHeading,
+	atom.H5:         BlockHeading,
+	atom.H6:         BlockHeading,
+	atom.Ul:         BlockList,
+	atom.Ol:         BlockList,
+	atom.Dl:         BlockList,
+	atom.Blockquote: BlockQuote,
+	atom.Figure:     BlockFigure,
+	atom.Img:        BlockFigure,
+	atom.Picture:    BlockFigure,
+	atom.Table:      BlockTable,
+	atom.Iframe:     BlockEmbed,
+	atom.Video:      BlockEmbed,
+	atom.Audio:      BlockEmbed,
+	atom.Embed:      BlockEmbed,
+	atom.Object:     BlockEmbed,
+}
+
+// contentBlock is a block, along with the nodes it was made from (a
+// single element, or a run of loose inline nodes)
+type contentBlock struct {
+	Block
+	nodes []*html.Node
+}
+
+// grabBlocks returns the blocks for Article.Blocks, with unique ids
+func grabBlocks(contentBlocks []contentBlock) []Block {
+	blocks := []Block{}
+	for _, cb := range contentBlocks {
+		blocks = append(blocks, cb.Block)
+	}
+
+	// make sure repeated blocks get unique ids
+	seen := map[string]int{}
+	for i := range blocks {
+		b := &blocks[i]
+		seen[b.ID]++
+		if cnt := seen[b.ID]; cnt > 1 {
+			b.ID = fmt.Sprintf("%s-%d", b.ID, cnt)
+		}
+	}
+	return blocks
+}
+
+// splitBlocks splits the (sanitised) content nodes up into blocks.
+// Containers (divs, sections etc) are descended into. Any loose text or
+// inline elements within them are gathered up into paragraphs.
+// The links, quotes and entities all use the same split, so their
+// Positions line up with Article.Blocks.
+func splitBlocks(contentNodes []*html.Node) []contentBlock {
+	blocks := []contentBlock{}
+	var inline []*html.Node
+
+	flush := func() {
+		if len(inline) > 0 {
+			if b, ok := inlineBlock(inline); ok {
+				blocks = append(blocks, contentBlock{b, inline})
+			}
+			inline = nil
+		}
+	}
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			inline = append(inline, n)
+			return
+		case html.ElementNode:
+		default:
+			return
+		}
+
+		if kind, ok := blockKinds[n.DataAtom]; ok {
+			flush()
+			if b, ok := makeBlock(n, kind); ok {
+				blocks = append(blocks, contentBlock{b, []*html.Node{n}})
+			}
+			return
+		}
+		if n.DataAtom == atom.Br {
+			flush()
+			return
+		}
+		if isBlockElement(n) || containsBlockElements(n) {
+			// container - look inside
+			flush()
+			for child := n.FirstChild; child != nil; child = child.NextSibling {
+				walk(child)
+			}
+			flush()
+			return
+		}
+		inline = append(inline, n)
+	}
+
+	for _, n := range contentNodes {
+		walk(n)
+	}
+	flush()
+	return blocks
+}
+
+// isBlockElement returns true for the containers we descend into
+func isBlockElement(n *html.Node) bool {
+	switch n.DataAtom {
+	case atom.Div, atom.Section, atom.Article, atom.Main, atom.Header, atom.Footer,
+		atom.Aside, atom.Nav, atom.Body, atom.Li, atom.Dd, atom.Dt, atom.Td, atom.Th,
+		atom.Tr, atom.Tbody, atom.Thead, atom.Tfoot, atom.Hr:
+		return true
+	}
+	return false
+}
+
+// makeBlock builds a block from a single element
+func makeBlock(n *html.Node, kind BlockKind) (Block, bool) {
+	b := Block{Kind: kind, HTML: renderHTML(n)}
+	switch kind {
+	case BlockHeading:
+		b.Level = int(n.Data[1] - '0')
+		b.Text = compressSpace(getTextContent(n))
+	case BlockList:
+		b.Text = childTexts(n, map[atom.Atom]bool{atom.Li: true, atom.Dt: true, atom.Dd: true}, "\n")
+	case BlockQuote:
+		b.Text = childTexts(n, map[atom.Atom]bool{atom.P: true}, "\n\n")
+	case BlockTable:
+		rows := []string{}
+		walkChildren(n, func(tr *html.Node) {
+			if tr.DataAtom != atom.Tr {
+				return
+			}
+			cells := []string{}
+			for td := tr.FirstChild; td != nil; td = td.NextSibling {
+				if td.DataAtom == atom.Td || td.DataAtom == atom.Th {
+					cells = append(cells, compressSpace(getTextContent(td)))
+				}
+			}
+			rows = append(rows, strings.Join(cells, "\t"))
+		})
+		b.Text = strings.Join(rows, "\n")
+	case BlockFigure:
+		b.Text = compressSpace(getTextContent(n))
+		if b.Text == "" {
+			// use the alt text
+			img := n
+			if img.DataAtom != atom.Img {
+				img = imagePats.imgSel.MatchFirst(n)
+			}
+			if img != nil {
+				b.Text = compressSpace(getAttr(img, "alt"))
+			}
+		}
+	case BlockEmbed:
+		b.Text = compressSpace(getAttr(n, "title"))
+	default:
+		b.Text = compressSpace(getTextContent(n))
+	}
+
+	if b.Text == "" && (kind != BlockFigure && kind != BlockEmbed) {
+		return b, false
+	}
+
+	// for images and embeds, include the urls in the id so different
+	// pictures with no caption get different ids
+	srcs := []string{}
+	if kind == BlockFigure || kind == BlockEmbed {
+		addSrc := func(child *html.Node) {
+			if src := getAttr(child, "src"); src != "" {
+				srcs = append(srcs, src)
+			}
+		}
+		addSrc(n)
+		walkChildren(n, addSrc)
+	}
+	b.ID = blockHash(kind, b.Text, srcs)
+	return b, true
+}
+
+// inlineBlock makes a paragraph out of a run of loose inline nodes
+func inlineBlock(nodes []*html.Node) (Block, bool) {
+	var txt, out bytes.Buffer
+	for _, n := range nodes {
+		txt.WriteString(getTextContent(n))
+		html.Render(&out, n)
+	}
+	b := Block{Kind: BlockParagraph, Text: compressSpace(txt.String()), HTML: strings.TrimSpace(out.String())}
+	b.ID = blockHash(b.Kind, b.Text, nil)
+	return b, b.Text != ""
+}
+
+// childTexts returns the text of the wanted children of n, joined by sep.
+// If there aren't any, the whole text of n is returned.
+func childTexts(n *html.Node, wanted map[atom.Atom]bool, sep string) string {
+	parts := []string{}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if wanted[child.DataAtom] {
+			if txt := compressSpace(getTextContent(child)); txt != "" {
+				parts = append(parts, txt)
+			}
+		}
+	}
+	if len(parts) == 0 {
+		return compressSpace(getTextContent(n))
+	}
+	return strings.Join(parts, sep)
+}
+
+// blockHash returns the (unsuffixed) id for a block
+func blockHash(kind BlockKind, txt string, srcs []string) string {
+	h := sha1.New()
+	h.Write([]byte(string(kind) + "\x00" + txt))
+	for _, src := range srcs {
+		h.Write([]byte("\x00" + src))
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// renderHTML renders a node to a string
+func renderHTML(n *html.Node) string {
+	var out bytes.Buffer
+	html.Render(&out, n)
+	return out.String()
+}
@@ -0,0 +1,75 @@
+package arts
+
+import (
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+	"testing"
+)
+
+func TestGrabBlocks(t *testing.T) {
+	root := parseDoc(`<html><body><div id="content">
+<h2>Foxes</h2>
+<p>The quick brown <em>fox</em>.</p>
+<div>Some loose text<br>and more</div>
+<ul><li>One</li><li>Two</li></ul>
+<blockquote><p>Quote one.</p><p>Quote two.</p></blockquote>
+<figure><img src="http://example.com/fox.jpg" alt="a fox"><figcaption>A fox.</figcaption></figure>
+<img src="http://example.com/dog.jpg" alt="">
+<table><tr><td>a</td><td>b</td></tr><tr><td>c</td><td>d</td></tr></table>
+<iframe src="http://example.com/embed/123"></iframe>
+<p>The quick brown <em>fox</em>.</p>
+</div></body></html>`)
+
+	content := []*html.Node{cascadia.MustCompile("#content").MatchFirst(root)}
+	blocks := grabBlocks(splitBlocks(content))
+
+	expected := []struct {
+		kind BlockKind
+		txt  string
+	}{
+		{BlockHeading, "Foxes"},
+		{BlockParagraph, "The quick brown fox."},
+		{BlockParagraph, "Some loose text"},
+		{BlockParagraph, "and more"},
+		{BlockList, "One\nTwo"},
+		{BlockQuote, "Quote one.\n\nQuote two."},
+		{BlockFigure, "A fox."},
+		{BlockFigure, ""},
+		{BlockTable, "a\tb\nc\td"},
+		{BlockEmbed, ""},
+		{BlockParagraph, "The quick brown fox."},
+	}
+	if len(blocks) != len(expected) {
+		for _, b := range blocks {
+			t.Logf("%+v", b)
+		}
+		t.Fatalf("got %d blocks (expected %d)", len(blocks), len(expected))
+	}
+	for i, b := range blocks {
+		if b.Kind != expected[i].kind || b.Text != expected[i].txt {
+			t.Errorf("block %d: got %s %q (expected %s %q)", i, b.Kind, b.Text, expected[i].kind, expected[i].txt)
+		}
+	}
+	if blocks[0].Level != 2 {
+		t.Errorf("bad heading level: %d", blocks[0].Level)
+	}
+	if blocks[1].HTML != "<p>The quick brown <em>fox</em>.</p>" {
+		t.Errorf("bad html: %q", blocks[1].HTML)
+	}
+
+	// ids should be unique, and the same for the same content
+	ids := map[string]bool{}
+	for _, b := range blocks {
+		if ids[b.ID] {
+			t.Errorf("duplicate id %s", b.ID)
+		}
+		ids[b.ID] = true
+	}
+	if blocks[10].ID != blocks[1].ID+"-2" {
+		t.Errorf("repeated block: got id %s (expected %s-2)", blocks[10].ID, blocks[1].ID)
+	}
+	again := grabBlocks(splitBlocks([]*html.Node{cascadia.MustCompile("#content").MatchFirst(parseDoc(`<div id="content"><p class="changed">The  quick brown <b>fox</b>.</p></div>`))}))
+	if len(again) != 1 || again[0].ID != blocks[1].ID {
+		t.Errorf("id not stable across markup changes: %+v", again)
+	}
+}
@@ -0,0 +1,299 @@
+package arts
+
+// comments.go - reader comments (native comment lists, disqus, livefyre
+// etc).
+//
+// Comment sections are always cut out of the page before the rest of the
+// extraction, so they can't leak into the content or authors. If asked
+// for, the individual comments are pulled out first.
+
+import (
+	"github.com/andybalholm/cascadia"
+	"github.com/bcampbell/fuzzytime"
+	"golang.org/x/net/html"
+	"regexp"
+	"strings"
+)
+
+var commentPats = struct {
+	sectionPat     *regexp.Regexp
+	itemClassPat   *regexp.Regexp
+	itemIDPat      *regexp.Regexp
+	itemTypeSel    cascadia.Selector
+	authorClassPat *regexp.Regexp
+	authorSel      cascadia.Selector
+	timeSel        cascadia.Selector
+	timeClassPat   *regexp.Regexp
+	dateSel        cascadia.Selector
+	metaClassPat   *regexp.Regexp
+	saysPat        *regexp.Regexp
+	paraSel        cascadia.Selector
+}{
+	// class/id (single tokens) for comment sections
+	regexp.MustCompile(`(?i)^(?:comments|commentlist|comment-?(?:list|section|area|thread|s-?container|s-?wrapper)|comments-(?:area|section|list|container|wrapper)|disqus_thread|livefyre(?:-comments)?|reader-?comments|user-?comments|talkback)$`),
+	// class (single tokens) for individual comments
+	regexp.MustCompile(`(?i)^(?:comment|comment-item|commentitem|single-comment|dsq-comment|fyre-comment-wrapper|c-comment)$`),
+	regexp.MustCompile(`(?i)^comment-?\d+$`),
+	cascadia.MustCompile(`[itemtype*="schema.org/Comment"]`),
+	regexp.MustCompile(`(?i)comment-?author|\bauthor\b|\bfn\b|user-?name|commenter|nickname|display-?name`),
+	cascadia.MustCompile(`[itemprop="author"]`),
+	cascadia.MustCompile(`time`),
+	regexp.MustCompile(`(?i)\b(?:date|time|timestamp|comment-?date|published)\b`),
+	cascadia.MustCompile(`[itemprop="dateCreated"], [itemprop="datePublished"]`),
+	// class (single tokens) for bits of comment furniture to ignore when
+	// grabbing the text
+	regexp.MustCompile(`(?i)^(?:comment-?meta(?:data)?|comment-?actions|comment-?footer|reply|comment-?reply-?link|reply-?link|votes?|vote-?(?:up|down|count)|likes?|like-?button|report|report-?(?:abuse|comment)|share|share-?(?:buttons|links)|permalink|avatar|says)$`),
+	regexp.MustCompile(`(?i)\s*(?:says|said|wrote)\s*:?\s*$`),
+	cascadia.MustCompile(`p`),
+}
+
+// matchesToken returns true if any class or id token of n matches pat
+func matchesToken(n *html.Node, pat *regexp.Regexp) bool {
+	for _, tok := range strings.Fields(getAttr(n, "class") + " " + getAttr(n, "id")) {
+		if pat.MatchString(tok) {
+			return true
+		}
+	}
+	return false
+}
+
+// isCommentItem returns true if n looks like a single comment
+func isCommentItem(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	for _, tok := range strings.Fields(getAttr(n, "class")) {
+		if commentPats.itemClassPat.MatchString(tok) {
+			return true
+		}
+	}
+	if commentPats.itemIDPat.MatchString(getAttr(n, "id")) {
+		return true
+	}
+	return commentPats.itemTypeSel.Match(n)
+}
+
+// minCommentItems is the number of individual comments a section needs
+// before it's believed to be a comment section
+const minCommentItems = 2
+
+// maxCommentSectionParaScore is the paragraphScore() above which a
+// paragraph (outside any individual comment) is taken to be article text
+const maxCommentSectionParaScore = 5.0
+
+// findCommentSections returns the (outermost) blocks holding reader comments.
+// Anything containing the headline is assumed to be a false positive, as
+// is anything without repeated comment items or holding article-like
+// paragraphs (eg an article wrapper with a "comments" class to style the
+// comments inside it).
+func findCommentSections(root *html.Node, headlineNode *html.Node) []*html.Node {
+	dbug := Debug.CommentsLogger
+	sections := []*html.Node{}
+	var sectionSel cascadia.Selector = func(n *html.Node) bool {
+		return n.Type == html.ElementNode && matchesToken(n, commentPats.sectionPat)
+	}
+	for _, n := range sectionSel.MatchAll(root) {
+		if headlineNode != nil && (n == headlineNode || contains(n, headlineNode)) {
+			dbug.Printf("ignore %s: contains headline\n", describeNode(n))
+			continue
+		}
+		nested := false
+		for _, sec := range sections {
+			if contains(sec, n) {
+				nested = true
+				break
+			}
+		}
+		if nested {
+			continue
+		}
+		if cnt := countCommentItems(n); cnt < minCommentItems {
+			dbug.Printf("ignore %s: only %d comment items\n", describeNode(n), cnt)
+			continue
+		}
+		if p := findArticleParagraph(n); p != nil {
+			dbug.Printf("ignore %s: holds article text %s\n", describeNode(n), describeNode(p))
+			continue
+		}
+		dbug.Printf("comment section: %s\n", describeNode(n))
+		sections = append(sections, n)
+	}
+	return sections
+}
+
+// countCommentItems returns the number of individual comments within sec
+func countCommentItems(sec *html.Node) int {
+	cnt := 0
+	walkChildren(sec, func(n *html.Node) {
+		if isCommentItem(n) {
+			cnt++
+		}
+	})
+	return cnt
+}
+
+// findArticleParagraph returns the first paragraph within sec which
+// scores like article text and isn't part of an individual comment
+func findArticleParagraph(sec *html.Node) *html.Node {
+	for _, p := range commentPats.paraSel.MatchAll(sec) {
+		inItem := false
+		for n := p; n != nil && n != sec; n = n.Parent {
+			if isCommentItem(n) {
+				inItem = true
+				break
+			}
+		}
+		if inItem {
+			continue
+		}
+		txt := getTextContent(p)
+		if len(txt) >= 25 && paragraphScore(txt) >= maxCommentSectionParaScore {
+			return p
+		}
+	}
+	return nil
+}
+
+// commentNode is a Comment under construction
+type commentNode struct {
+	Comment
+	replies []*commentNode
+}
+
+func (c *commentNode) toComment() Comment {
+	out := c.Comment
+	for _, r := range c.replies {
+		out.Replies = append(out.Replies, r.toComment())
+	}
+	return out
+}
+
+// grabComments pulls the individual comments out of the comment sections.
+// Returns the top-level comments (in document order), with replies nested
+// within.
+func grabComments(sections []*html.Node) []Comment {
+	dbug := Debug.CommentsLogger
+
+	top := []*commentNode{}
+	for _, sec := range sections {
+		items := map[*html.Node]*commentNode{}
+		walkChildren(sec, func(n *html.Node) {
+			if !isCommentItem(n) {
+				return
+			}
+			c, ok := parseComment(n)
+			if !ok {
+				return
+			}
+			cn := &commentNode{Comment: c}
+			items[n] = cn
+			// reply to an earlier comment?
+			for p := n.Parent; p != nil && p != sec; p = p.Parent {
+				if parent, got := items[p]; got {
+					parent.replies = append(parent.replies, cn)
+					return
+				}
+			}
+			top = append(top, cn)
+		})
+		dbug.Printf("%s: %d comments\n", describeNode(sec), len(items))
+	}
+
+	out := make([]Comment, 0, len(top))
+	for _, cn := range top {
+		out = append(out, cn.toComment())
+	}
+	return out
+}
+
+// parseComment picks apart a single comment. The original node is left
+// untouched.
+func parseComment(item *html.Node) (Comment, bool) {
+	dbug := Debug.CommentsLogger
+	c := Comment{}
+	item = cloneNode(item)
+
+	// lose any replies
+	doomed := []*html.Node{}
+	walkChildren(item, func(n *html.Node) {
+		if isCommentItem(n) {
+			doomed = append(doomed, n)
+		}
+	})
+	zapNodes(doomed)
+
+	// author
+	var authorSel cascadia.Selector = func(n *html.Node) bool {
+		return n.Type == html.ElementNode &&
+			(commentPats.authorSel.Match(n) || commentPats.authorClassPat.MatchString(getAttr(n, "class")))
+	}
+	// (the item itself can have author classes, eg wordpress
+	// "comment-author-fred", so only look inside it)
+	if a := matchFirstDescendant(item, authorSel); a != nil {
+		c.Author = commentPats.saysPat.ReplaceAllString(compressSpace(getTextContent(a)), "")
+		c.Author = strings.TrimSpace(strings.TrimPrefix(c.Author, "by "))
+		zapNodes([]*html.Node{a})
+	}
+
+	// timestamp
+	timeNode := matchFirstDescendant(item, commentPats.timeSel)
+	if timeNode == nil {
+		timeNode = matchFirstDescendant(item, commentPats.dateSel)
+	}
+	if timeNode == nil {
+		var timeSel cascadia.Selector = func(n *html.Node) bool {
+			return n.Type == html.ElementNode && commentPats.timeClassPat.MatchString(getAttr(n, "class"))
+		}
+		timeNode = matchFirstDescendant(item, timeSel)
+	}
+	if timeNode != nil {
+		txt := getAttr(timeNode, "datetime")
+		if txt == "" {
+			txt = getAttr(timeNode, "content")
+		}
+		if txt == "" {
+			txt = getTextContent(timeNode)
+		}
+		dt, _, _ := fuzzytime.WesternContext.Extract(txt)
+		if !dt.Date.Empty() {
+			c.Published = dt.ISOFormat()
+		}
+		zapNodes([]*html.Node{timeNode})
+	}
+
+	// lose reply links, avatars etc...
+	doomed = []*html.Node{}
+	walkChildren(item, func(n *html.Node) {
+		if n.Type == html.ElementNode && matchesToken(n, commentPats.metaClassPat) {
+			doomed = append(doomed, n)
+		}
+	})
+	zapNodes(doomed)
+
+	// ...and whatever's left is the text
+	paras := []string{}
+	for _, p := range commentPats.paraSel.MatchAll(item) {
+		if txt := compressSpace(getTextContent(p)); txt != "" {
+			paras = append(paras, txt)
+		}
+	}
+	if len(paras) > 0 {
+		c.Text = strings.Join(paras, "\n\n")
+	} else {
+		c.Text = compressSpace(getTextContent(item))
+	}
+	if c.Text == "" {
+		return c, false
+	}
+	dbug.Printf("  %s %q: %q\n", c.Published, c.Author, snip(c.Text, 40))
+	return c, true
+}
+
+// zapNodes removes nodes from the tree
+func zapNodes(nodes []*html.Node) {
+	for _, n := range nodes {
+		if n.Parent != nil {
+			n.Parent.RemoveChild(n)
+		}
+	}
+}
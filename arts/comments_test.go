@@ -0,0 +1,156 @@
+package arts
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestComments(t *testing.T) {
+	para := testPara("")
+	src := `<html><head><title>Foxes and dogs</title></head><body>
+<h1>Foxes and dogs</h1>
+<p class="byline">By <a rel="author" href="/profile/fred-bloggs">Fred Bloggs</a></p>
+<div class="article">` + para + para + para + `</div>
+<div id="comments" class="comments-area">
+<h2>3 thoughts on "Foxes and dogs"</h2>
+<ol class="commentlist">
+ <li class="comment" id="comment-1">
+  <article class="comment-body">
+   <footer class="comment-meta">
+    <div class="comment-author vcard"><b class="fn">Jane Doe</b> <span class="says">says:</span></div>
+    <div class="comment-metadata"><a href="#comment-1"><time datetime="2017-06-09T10:15:00Z">June 9, 2017 at 10:15 am</time></a></div>
+   </footer>
+   <div class="comment-content"><p>Typical fox behaviour, if you ask me, and I have seen plenty of foxes.</p><p>Second para.</p></div>
+   <div class="reply"><a class="comment-reply-link" href="#">Reply</a></div>
+  </article>
+  <ol class="children">
+   <li class="comment" id="comment-2">
+    <article class="comment-body">
+     <footer class="comment-meta">
+      <div class="comment-author vcard"><b class="fn">John Smith</b> <span class="says">says:</span></div>
+      <div class="comment-metadata"><time datetime="2017-06-09T11:00:00Z">June 9, 2017 at 11:00 am</time></div>
+     </footer>
+     <div class="comment-content"><p>The dog had it coming.</p></div>
+    </article>
+   </li>
+  </ol>
+ </li>
+ <li class="comment" id="comment-3">
+  <article class="comment-body">
+   <footer class="comment-meta"><div class="comment-author vcard"><b class="fn">Bob Jones</b></div></footer>
+   <div class="comment-content"><p>First!</p></div>
+  </article>
+ </li>
+</ol>
+</div>
+</body></html>`
+
+	for _, withComments := range []bool{false, true} {
+		art, err := ExtractFromHTMLWithOptions([]byte(src), "http://example.com/news/foxes-and-dogs", &Options{Comments: withComments})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, txt := range []string{"Typical fox", "had it coming", "First!"} {
+			if strings.Contains(art.Content, txt) {
+				t.Errorf("comment text %q leaked into content", txt)
+			}
+		}
+		if len(art.Authors) != 1 || art.Authors[0].Name != "Fred Bloggs" {
+			t.Errorf("bad authors: %v", art.Authors)
+		}
+		if !withComments {
+			if len(art.Comments) != 0 {
+				t.Errorf("got comments without asking")
+			}
+			continue
+		}
+
+		if len(art.Comments) != 2 {
+			t.Fatalf("got %d top-level comments (expected 2)", len(art.Comments))
+		}
+		first, last := art.Comments[0], art.Comments[1]
+		if first.Author != "Jane Doe" || first.Published != "2017-06-09T10:15:00Z" {
+			t.Errorf("bad comment: %+v", first)
+		}
+		if first.Text != "Typical fox behaviour, if you ask me, and I have seen plenty of foxes.\n\nSecond para." {
+			t.Errorf("bad comment text: %q", first.Text)
+		}
+		if len(first.Replies) != 1 || first.Replies[0].Author != "John Smith" || first.Replies[0].Text != "The dog had it coming." {
+			t.Errorf("bad replies: %+v", first.Replies)
+		}
+		if last.Author != "Bob Jones" || last.Text != "First!" || len(last.Replies) != 0 {
+			t.Errorf("bad comment: %+v", last)
+		}
+	}
+}
+
+func TestWordpressComments(t *testing.T) {
+	para := testPara("")
+	src := `<html><head><title>Foxes and dogs</title></head><body>
+<h1>Foxes and dogs</h1>
+<div class="article">` + para + para + para + `</div>
+<div id="comments" class="comments-area">
+<ol class="comment-list">
+ <li id="comment-12" class="comment byuser comment-author-fred bypostauthor even thread-even depth-1">
+  <article id="div-comment-12" class="comment-body">
+   <footer class="comment-meta">
+    <div class="comment-author vcard"><img alt="" src="http://example.com/avatar.png" class="avatar avatar-32 photo" height="32" width="32"><b class="fn"><a href="http://example.com/fred" class="url">Fred</a></b> <span class="says">says:</span></div>
+    <div class="comment-metadata"><a href="http://example.com/news/foxes-and-dogs#comment-12"><time datetime="2017-06-09T10:15:00+00:00">June 9, 2017 at 10:15 am</time></a></div>
+   </footer>
+   <div class="comment-content shareable"><p>Foxes will be foxes.</p></div>
+   <div class="reply"><a rel="nofollow" class="comment-reply-link" href="#">Reply</a></div>
+  </article>
+ </li>
+ <li id="comment-13" class="comment even thread-odd depth-1">
+  <article id="div-comment-13" class="comment-body">
+   <footer class="comment-meta">
+    <div class="comment-author vcard"><b class="fn">Jane</b> <span class="says">says:</span></div>
+   </footer>
+   <div class="comment-content"><p>And dogs will be dogs.</p></div>
+  </article>
+ </li>
+</ol>
+</div>
+</body></html>`
+
+	art, err := ExtractFromHTMLWithOptions([]byte(src), "http://example.com/news/foxes-and-dogs", &Options{Comments: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(art.Comments) != 2 {
+		t.Fatalf("got %d comments (expected 2)", len(art.Comments))
+	}
+	c := art.Comments[0]
+	if c.Author != "Fred" || c.Published != "2017-06-09T10:15:00+00:00" || c.Text != "Foxes will be foxes." {
+		t.Errorf("bad comment: %+v", c)
+	}
+}
+
+func TestCommentClassOnArticle(t *testing.T) {
+	para := testPara("")
+	for name, src := range map[string]string{
+		// "comments" class just to style the comments within
+		"wrapper": `<html><head><title>Foxes and dogs</title></head><body>
+<h1>Foxes and dogs</h1>
+<div class="article has-comments comments">` + para + para + para + `
+<ol class="commentlist">
+ <li class="comment" id="comment-1"><p>Typical fox behaviour.</p></li>
+ <li class="comment" id="comment-2"><p>The dog had it coming.</p></li>
+</ol>
+</div>
+</body></html>`,
+		// no actual comments in it
+		"no items": `<html><head><title>Foxes and dogs</title></head><body>
+<h1>Foxes and dogs</h1>
+<div class="story comments">` + para + para + para + `</div>
+</body></html>`,
+	} {
+		art, err := ExtractFromHTML([]byte(src), "http://example.com/news/foxes-and-dogs")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(art.Content, "quick brown fox") {
+			t.Errorf("%s: article text lost (content %q)", name, art.Content)
+		}
+	}
+}
@@ -17,11 +17,49 @@ import (
 	"golang.org/x/net/html/atom"
 	"log"
 	"math"
+	"net/url"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 )
 
+// contentFlags control the optional parts of the content extraction
+type contentFlags int
+
+const (
+	// flagStripUnlikelys - ignore nodes which look like comments, sidebars etc
+	flagStripUnlikelys contentFlags = 1 << iota
+	// flagWeightClasses - score nodes using their class and id
+	flagWeightClasses
+	// flagLandmarks - use html5/aria landmarks (see landmarks.go)
+	flagLandmarks
+)
+
+// defaultContentFlags are the flags used unless Options says otherwise
+const defaultContentFlags = flagStripUnlikelys | flagWeightClasses | flagLandmarks
+
+// relaxOrder is the order in which flags are dropped if the extraction
+// doesn't find enough text
+var relaxOrder = []contentFlags{flagStripUnlikelys, flagWeightClasses, flagLandmarks}
+
+func (flags contentFlags) String() string {
+	names := []string{}
+	if flags&flagStripUnlikelys != 0 {
+		names = append(names, "stripunlikelys")
+	}
+	if flags&flagWeightClasses != 0 {
+		names = append(names, "weightclasses")
+	}
+	if flags&flagLandmarks != 0 {
+		names = append(names, "landmarks")
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, "+")
+}
+
 // todo: define a specialised type for content candidates?
 // candidateMap stores candidates for quick lookup by node
 type candidateMap map[*html.Node]candidate
@@ -50,7 +88,7 @@ func (candidates candidateMap) dump(dbug *log.Logger) {
 }
 
 // assign initial scoring to a potential content candidate
-func initializeNode(c candidate) {
+func initializeNode(c candidate, flags contentFlags) {
 	switch c.node().DataAtom {
 	case atom.Article:
 		c.addPoints(8, "<article>")
@@ -64,8 +102,16 @@ func initializeNode(c candidate) {
 		c.addPoints(-5, "heading")
 	}
 
-	if score := getClassWeight(c.node()); score != 0 {
-		c.addPoints(score, "class/id score")
+	if flags&flagWeightClasses != 0 {
+		if score := getClassWeight(c.node()); score != 0 {
+			c.addPoints(score, "class/id score")
+		}
+	}
+
+	if flags&flagLandmarks != 0 {
+		if score := landmarkWeight(c.node()); score != 0 {
+			c.addPoints(score, "within <main>")
+		}
 	}
 }
 
@@ -83,26 +129,143 @@ func removeScripts(root *html.Node) []*html.Node {
 var contentPats = struct {
 	unlikelyCandidates   *regexp.Regexp
 	okMaybeItsACandidate *regexp.Regexp
+	commentSystems       *regexp.Regexp
 	positivePat          *regexp.Regexp
 	negativePat          *regexp.Regexp
 	itemPropSel          cascadia.Selector
+	contentScopeSel      cascadia.Selector
 }{
 	regexp.MustCompile(`(?i)combx|comment|community|disqus|livefyre|extra|foot|header|menu|remark|rss|shoutbox|sidebar|sponsor|ad-break|agegate|pagination|pager|popup|tweet|twitter`),
 	regexp.MustCompile(`(?i)and|article|body|column|main|shadow`),
+	// always unlikely, even if okMaybeItsACandidate matches (eg ".dsq-comment-body")
+	regexp.MustCompile(`(?i)dsq-|disqus|livefyre|comment-(?:body|content|text|list)|comments-(?:area|section|list|container)`),
 	regexp.MustCompile(`(?i)article|body|content|entry|hentry|main|page|pagination|post|text|blog|story`),
 	regexp.MustCompile(`(?i)combx|comment|com-|contact|foot|footer|footnote|masthead|media|meta|outbrain|promo|related|scroll|shoutbox|sidebar|sponsor|shopping|tags|tool|widget|subscribe`),
 	cascadia.MustCompile(`[itemprop="articleBody"]`),
+	// containers which should hold the whole article (see assembleContent())
+	cascadia.MustCompile(`article, main, [role="main"], [role="article"], [itemprop="articleBody"]`),
 }
 
+// minContentLength is the amount of text (in bytes) a pass of grabContent
+// has to find before we're happy with it
+const minContentLength = 250
+
 // grabContent finds the nodes in the page which contain the actual article text.
 // Returns a slice of node pointers (in order), and a map containing all
 // the content scores calculated. The scores can be used in a later pass to help
 // remove cruft nodes in the text (eg share/like buttons etc)
-func grabContent(root *html.Node) ([]*html.Node, candidateMap) {
+//
+// Like readability, it starts off strict, and if that doesn't find
+// enough text it tries again with progressively relaxed settings. The best
+// result is returned, along with the flags of the pass which produced it.
+// The tree is only modified once the best pass is chosen (unlikely nodes
+// within the content are removed).
+func grabContent(root *html.Node, flags contentFlags) ([]*html.Node, candidateMap, contentFlags) {
 	dbug := Debug.ContentLogger
-	var candidates = make(candidateMap)
 
-	stripUnlikelyCandidates := false
+	var bestNodes []*html.Node
+	var bestCandidates candidateMap
+	var bestUnlikely map[*html.Node]bool
+	var bestFlags contentFlags
+	bestLen := -1
+
+	passFlags := flags
+	for pass := 1; ; pass++ {
+		dbug.Printf("pass %d (%s)\n", pass, passFlags)
+		contentNodes, candidates, unlikely := grabContentPass(root, passFlags)
+		textLen := contentLength(contentNodes, unlikely)
+		dbug.Printf("pass %d (%s) got %d bytes of text\n", pass, passFlags, textLen)
+		if textLen > bestLen {
+			bestNodes, bestCandidates, bestUnlikely, bestFlags = contentNodes, candidates, unlikely, passFlags
+			bestLen = textLen
+		}
+		if textLen >= minContentLength {
+			break
+		}
+
+		// relax a bit and try again
+		relaxed := false
+		for _, f := range relaxOrder {
+			if passFlags&f != 0 {
+				passFlags &^= f
+				relaxed = true
+				break
+			}
+		}
+		if !relaxed {
+			break
+		}
+	}
+	dbug.Printf("using %s (%d bytes)\n", bestFlags, bestLen)
+
+	// now we've decided, zap the unlikely stuff from the content
+	out := make([]*html.Node, 0, len(bestNodes))
+	doomed := []*html.Node{}
+	for _, n := range bestNodes {
+		if bestUnlikely[n] {
+			continue
+		}
+		out = append(out, n)
+		walkChildren(n, func(child *html.Node) {
+			if bestUnlikely[child] {
+				doomed = append(doomed, child)
+			}
+		})
+	}
+	for _, n := range doomed {
+		if n.Parent != nil {
+			dbug.Printf("Removing unlikely candidate - %s\n", describeNode(n))
+			n.Parent.RemoveChild(n)
+		}
+	}
+	return out, bestCandidates, bestFlags
+}
+
+// contentLength returns the amount of text in the content nodes, ignoring
+// anything in the unlikely nodes
+func contentLength(contentNodes []*html.Node, unlikely map[*html.Node]bool) int {
+	var count func(*html.Node) int
+	count = func(n *html.Node) int {
+		if unlikely[n] {
+			return 0
+		}
+		if n.Type == html.TextNode {
+			return len(n.Data)
+		}
+		total := 0
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			total += count(child)
+		}
+		return total
+	}
+	total := 0
+	for _, n := range contentNodes {
+		total += count(n)
+	}
+	return total
+}
+
+// isUnlikelyCandidate returns true if the node looks like it holds comments,
+// sidebars, menus or other non-article stuff.
+func isUnlikelyCandidate(n *html.Node) bool {
+	if n.DataAtom == atom.Body || n.DataAtom == atom.Html {
+		return false
+	}
+	unlikelyMatchString := getAttr(n, "class") + " " + getAttr(n, "id")
+	if contentPats.commentSystems.MatchString(unlikelyMatchString) {
+		return true
+	}
+	return contentPats.unlikelyCandidates.MatchString(unlikelyMatchString) &&
+		!contentPats.okMaybeItsACandidate.MatchString(unlikelyMatchString)
+}
+
+// grabContentPass does the work for grabContent, using one set of flags.
+// The tree is left untouched - instead, nodes which would be stripped as
+// unlikely candidates are returned.
+func grabContentPass(root *html.Node, flags contentFlags) ([]*html.Node, candidateMap, map[*html.Node]bool) {
+	dbug := Debug.ContentLogger
+	var candidates = make(candidateMap)
+	unlikely := map[*html.Node]bool{}
 
 	/**
 	 * First, node prepping. Trash nodes that look cruddy (like ones with the class name "comment", etc), and turn divs
@@ -114,21 +277,27 @@ func grabContent(root *html.Node) ([]*html.Node, candidateMap) {
 
 	nodesToScore := make([]*html.Node, 0, 128)
 
+	var lastUnlikely *html.Node
 	allNodes := cascadia.MustCompile("*")
 	for _, node := range allNodes.MatchAll(root) {
-		if stripUnlikelyCandidates {
-			unlikelyMatchString := getAttr(node, "class") + getAttr(node, "id")
-
-			// TODO: this lets through things it shouldn't, eg ".dsq-comment-body"
-			if contentPats.unlikelyCandidates.MatchString(unlikelyMatchString) == true &&
-				contentPats.okMaybeItsACandidate.MatchString(unlikelyMatchString) == false &&
-				node.DataAtom != atom.Body {
-				dbug.Printf("Removing unlikely candidate - %s\n", describeNode(node))
-				node.Parent.RemoveChild(node)
+		if flags&flagStripUnlikelys != 0 {
+			// (nodes are in document order, so this skips the whole subtree)
+			if lastUnlikely != nil && contains(lastUnlikely, node) {
+				continue
+			}
+			if isUnlikelyCandidate(node) {
+				dbug.Printf("Unlikely candidate - %s\n", describeNode(node))
+				unlikely[node] = true
+				lastUnlikely = node
 				continue
 			}
 		}
 
+		if flags&flagLandmarks != 0 && inExcludedLandmark(node) {
+			// nav, sidebar etc - don't even bother scoring
+			continue
+		}
+
 		if node.DataAtom == atom.P || node.DataAtom == atom.Td || node.DataAtom == atom.Pre {
 			nodesToScore = append(nodesToScore, node)
 		} else if node.DataAtom == atom.Div {
@@ -167,25 +336,15 @@ func grabContent(root *html.Node) ([]*html.Node, candidateMap) {
 		}
 
 		if _, exists := candidates[parentNode]; !exists {
-			initializeNode(candidates.get(parentNode))
+			initializeNode(candidates.get(parentNode), flags)
 		}
 		if grandParentNode != nil {
 			if _, exists := candidates[grandParentNode]; !exists {
-				initializeNode(candidates.get(grandParentNode))
+				initializeNode(candidates.get(grandParentNode), flags)
 			}
 		}
 
-		contentScore := 1.0
-
-		// add points for any commas
-		contentScore += float64(strings.Count(innerText, ","))
-
-		// 1 point for every 100 bytes in this para, up to 3 points
-		foo := float64(len(innerText)) / 100
-		if foo > 3 {
-			foo = 3
-		}
-		contentScore += foo
+		contentScore := paragraphScore(innerText)
 
 		/* Add the content score to the parent. The grandparent gets half. */
 		candidates.get(parentNode).addPoints(contentScore, fmt.Sprintf("Child content %s %s", describeNode(node), strconv.Quote(snip(innerText, 12))))
@@ -201,7 +360,7 @@ func grabContent(root *html.Node) ([]*html.Node, candidateMap) {
 	if len(candidates) == 0 {
 		// oh.
 		dbug.Printf("no candidates\n")
-		return contentNodes, candidates
+		return contentNodes, candidates, unlikely
 	}
 
 	/**
@@ -242,6 +401,8 @@ func grabContent(root *html.Node) ([]*html.Node, candidateMap) {
 		useIt := false
 		if siblingNode == topCandidate.node() {
 			useIt = true
+		} else if flags&flagLandmarks != 0 && excludedLandmarks[landmarkRole(siblingNode)] {
+			dbug.Printf("skip sibling %s: %s landmark\n", describeNode(siblingNode), landmarkRole(siblingNode))
 		} else {
 
 			contentBonus := 0.0
@@ -273,12 +434,93 @@ func grabContent(root *html.Node) ([]*html.Node, candidateMap) {
 
 	}
 
+	contentNodes = assembleContent(topCandidate, contentNodes, candidates, siblingScoreThreshold)
+
 	dbug.Printf("got %d content nodes:\n", len(contentNodes))
 	for _, n := range contentNodes {
 		dbug.Printf("  %s\n", describeNode(n))
 	}
 
-	return contentNodes, candidates
+	return contentNodes, candidates, unlikely
+}
+
+// assembleContent looks for more content outside the top candidate and its
+// siblings. Articles are often split up into separate containers (ad slots
+// between chunks of text, pull-quote wrappers, multiple <section>s...), so
+// any other decent-scoring regions within the same <article> (or <main> etc)
+// are gathered up too.
+// Returns the content nodes in document order.
+func assembleContent(topCandidate candidate, contentNodes []*html.Node, candidates candidateMap, threshold float64) []*html.Node {
+	dbug := Debug.ContentLogger
+
+	top := topCandidate.node()
+	scope := closest(top.Parent, contentPats.contentScopeSel)
+	if scope == nil {
+		dbug.Printf("assembly: no article container - just using top candidate and siblings\n")
+		return contentNodes
+	}
+	dbug.Printf("assembly: looking for more content within %s\n", describeNode(scope))
+
+	overlaps := func(n *html.Node) bool {
+		for _, got := range contentNodes {
+			if got == n || contains(got, n) || contains(n, got) {
+				return true
+			}
+		}
+		return false
+	}
+
+	// best regions first, so they win out over their ancestors/descendants
+	// (stable sort, so ties go to the earlier one)
+	regions := candidateList{}
+	walkChildren(scope, func(n *html.Node) {
+		if c, ok := candidates[n]; ok {
+			regions = append(regions, c)
+		}
+	})
+	sort.Stable(Reverse{regions})
+
+	added := 0
+	for _, c := range regions {
+		n := c.node()
+		if overlaps(n) {
+			continue
+		}
+		useIt := false
+		if c.total() >= threshold {
+			useIt = true
+		} else if c.total() > 0 {
+			// low score, but might just be a short run of paragraphs
+			// split off by an ad or something
+			if len(getTextContent(n)) >= 80 && getLinkDensity(n) < 0.25 {
+				useIt = true
+			}
+		}
+		if !useIt {
+			dbug.Printf("  skip region %s (score %f)\n", describeNode(n), c.total())
+			continue
+		}
+		dbug.Printf("  add region %s (score %f)\n", describeNode(n), c.total())
+		contentNodes = append(contentNodes, n)
+		added++
+	}
+
+	if added == 0 {
+		return contentNodes
+	}
+
+	// put everything back into document order
+	chosen := make(map[*html.Node]bool, len(contentNodes))
+	for _, n := range contentNodes {
+		chosen[n] = true
+	}
+	ordered := make([]*html.Node, 0, len(contentNodes))
+	walkChildren(scope, func(n *html.Node) {
+		if chosen[n] {
+			ordered = append(ordered, n)
+		}
+	})
+	return ordered
 }
 
 /*
@@ -319,12 +561,18 @@ func getClassWeight(n *html.Node) float64 {
 
 // Remove all extraneous crap in the content - related articles, share buttons etc...
 // (equivalent to prepArticle() in readbility.js)
-func removeCruft(contentNodes []*html.Node, candidates candidateMap) {
+func removeCruft(contentNodes []*html.Node, candidates candidateMap, flags contentFlags, policy *SanitisePolicy) {
 	dbug := Debug.ContentLogger
 	dbug.Printf("Cruft removal\n")
 
-	zapConditionally(contentNodes, "form", candidates)
-	zap(contentNodes, "object")
+	if flags&flagLandmarks != 0 {
+		zapLandmarks(contentNodes)
+	}
+
+	zapConditionally(contentNodes, "form", candidates, flags)
+	if !policy.allows(atom.Object) {
+		zap(contentNodes, "object")
+	}
 	zap(contentNodes, "h1")
 
 	// If there is only one h2, they are probably using it
@@ -338,14 +586,16 @@ func removeCruft(contentNodes []*html.Node, candidates candidateMap) {
 	if h2Count == 1 {
 		zap(contentNodes, "h2")
 	}
-	zap(contentNodes, "iframe")
+	if !policy.allows(atom.Iframe) {
+		zap(contentNodes, "iframe")
+	}
 
 	//cleanHeaders()
 
 	/* Do these last as the previous stuff may have removed junk that will affect these */
-	zapConditionally(contentNodes, "table", candidates)
-	zapConditionally(contentNodes, "ul", candidates)
-	zapConditionally(contentNodes, "div", candidates)
+	zapConditionally(contentNodes, "table", candidates, flags)
+	zapConditionally(contentNodes, "ul", candidates, flags)
+	zapConditionally(contentNodes, "div", candidates, flags)
 }
 
 func zap(contentNodes []*html.Node, tagSel string) {
@@ -368,14 +618,17 @@ func zap(contentNodes []*html.Node, tagSel string) {
  * Clean a set of elements, removing all matching tags if they look fishy.
  * "Fishy" is an algorithm based on content length, classnames, link density, number of images & embeds, etc.
  **/
-func zapConditionally(contentNodes []*html.Node, tagSel string, candidates candidateMap) {
+func zapConditionally(contentNodes []*html.Node, tagSel string, candidates candidateMap, flags contentFlags) {
 	dbug := Debug.ContentLogger
 
 	doomed := make([]*html.Node, 0, 32)
 	sel := cascadia.MustCompile(tagSel)
 	for _, e := range contentNodes {
 		for _, node := range sel.MatchAll(e) {
-			weight := getClassWeight(node)
+			weight := 0.0
+			if flags&flagWeightClasses != 0 {
+				weight = getClassWeight(node)
+			}
 			var contentScore float64 = 0.0
 			if c, ok := candidates[node]; ok {
 				contentScore = c.total()
@@ -444,19 +697,54 @@ func zapConditionally(contentNodes []*html.Node, tagSel string, candidates candi
 // - remove comments
 // - trim whitespace
 // - remove non-essential attrs (TODO: still some more to do on this)
-// - TODO make links absolute
-func sanitiseContent(contentNodes []*html.Node) []*html.Node {
+// - make urls absolute (and remove javascript: and data: ones)
+// Content nodes which the policy doesn't allow are replaced by their
+// children (they're never dropped outright - that'd lose the whole article
+// if the top candidate happened to be, say, a <td>)
+func sanitiseContent(contentNodes []*html.Node, baseURL *url.URL, policy *SanitisePolicy) []*html.Node {
 
+	nodes := make([]*html.Node, 0, len(contentNodes))
 	for _, node := range contentNodes {
-		tidyNode(node)
+		tidyNode(node, policy)
+		absoluteURLs(node, baseURL)
+		if policy.allows(node.DataAtom) {
+			nodes = append(nodes, node)
+			continue
+		}
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			nodes = append(nodes, child)
+		}
 	}
 
 	// return only nodes with some remaining content
-	out := make([]*html.Node, 0, len(contentNodes))
-	for _, node := range contentNodes {
-		if node.FirstChild != nil {
-			out = append(out, node)
+	out := make([]*html.Node, 0, len(nodes))
+	for _, node := range nodes {
+		switch node.Type {
+		case html.ElementNode:
+			if node.FirstChild != nil || node.DataAtom == atom.Img {
+				out = append(out, node)
+			}
+		case html.TextNode:
+			if strings.TrimSpace(node.Data) != "" {
+				out = append(out, node)
+			}
 		}
 	}
 	return out
 }
+
+// paragraphScore rates how content-y a paragraph of text looks: a point
+// for being there, a point per comma, and a point per 100 bytes (up to 3).
+func paragraphScore(txt string) float64 {
+	score := 1.0
+
+	// add points for any commas
+	score += float64(strings.Count(txt, ","))
+
+	// 1 point for every 100 bytes in this para, up to 3 points
+	foo := float64(len(txt)) / 100
+	if foo > 3 {
+		foo = 3
+	}
+	return score + foo
+}
@@ -0,0 +1,133 @@
+package arts
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNonSiblingContent(t *testing.T) {
+
+	testData := []struct {
+		name string
+		src  string
+	}{
+		{"sections", `<html><body><article>
+<h1>Foxes and dogs</h1>
+<section><div class="chunk">` + testPara("PART ONE.") + testPara("PART TWO.") + testPara("PART THREE.") + `</div></section>
+<section><div class="chunk-b">` + testPara("PART FOUR.") + `</div></section>
+<section><div class="chunk-c">` + testPara("PART FIVE.") + testPara("PART SIX.") + `</div></section>
+</article>
+<aside><div>` + testPara("NOT CONTENT.") + `</div></aside>
+</body></html>`},
+		{"pullquote wrapper", `<html><body><main>
+<div class="story"><div class="txt">` + testPara("PART ONE.") + testPara("PART TWO.") + testPara("PART THREE.") + `</div>
+<div class="pq-wrap"><div class="inner"><blockquote>Foxes!</blockquote>` + testPara("PART FOUR.") + `</div></div></div>
+<div class="more"><div>` + testPara("PART FIVE.") + testPara("PART SIX.") + `</div></div>
+</main>
+<div class="elsewhere"><div>` + testPara("NOT CONTENT.") + `</div></div>
+</body></html>`},
+	}
+
+	for _, dat := range testData {
+		art, err := ExtractFromHTML([]byte(dat.src), "http://example.com/news/foxes-and-dogs")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// check everything is there, in order
+		pos := 0
+		for _, part := range []string{"PART ONE", "PART TWO", "PART THREE", "PART FOUR", "PART FIVE", "PART SIX"} {
+			i := strings.Index(art.Content[pos:], part)
+			if i < 0 {
+				t.Errorf("%s: missing or out of order: %s", dat.name, part)
+				continue
+			}
+			pos += i
+		}
+		if strings.Contains(art.Content, "NOT CONTENT") {
+			t.Errorf("%s: picked up content from outside article", dat.name)
+		}
+	}
+}
+
+func TestContentPasses(t *testing.T) {
+
+	// comments should be stripped on the first pass
+	root := parseDoc(`<html><body><div class="story">` + testPara("ARTICLE.") + testPara("ARTICLE.") + testPara("ARTICLE.") +
+		`<div class="dsq-comment-body">` + testPara("COMMENT,,,,,,,,") + testPara("COMMENT,,,,,,,,") + `</div>` + testPara("ARTICLE.") +
+		`</div></body></html>`)
+	contentNodes, _, flags := grabContent(root, defaultContentFlags)
+	if flags != defaultContentFlags {
+		t.Errorf("comments: used %s (expected %s)", flags, defaultContentFlags)
+	}
+	txt := ""
+	for _, n := range contentNodes {
+		txt += getTextContent(n)
+	}
+	if strings.Count(txt, "ARTICLE") != 4 || strings.Contains(txt, "COMMENT") {
+		t.Errorf("comments: bad content: %q", txt)
+	}
+
+	// the whole article looks unlikely, so a relaxed pass should be used
+	root = parseDoc(`<html><body><div class="post has-comments">` + testPara("ARTICLE.") + testPara("ARTICLE.") + testPara("ARTICLE.") +
+		`</div><div class="promo"><p>Buy stuff!</p></div></body></html>`)
+	contentNodes, _, flags = grabContent(root, defaultContentFlags)
+	if flags&flagStripUnlikelys != 0 {
+		t.Errorf("relaxed: used %s (expected stripunlikelys to be dropped)", flags)
+	}
+	txt = ""
+	for _, n := range contentNodes {
+		txt += getTextContent(n)
+	}
+	if strings.Count(txt, "ARTICLE") != 3 {
+		t.Errorf("relaxed: bad content: %q", txt)
+	}
+}
+
+func TestNilOptions(t *testing.T) {
+	src := `<html><head><title>Foxes and dogs</title></head><body><article><h1>Foxes and dogs</h1>
+` + testPara("") + `
+</article></body></html>`
+	expected, err := ExtractFromHTML([]byte(src), "http://example.com/news/foxes-and-dogs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	art, err := ExtractFromHTMLWithOptions([]byte(src), "http://example.com/news/foxes-and-dogs", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if art.Headline != expected.Headline || art.Content != expected.Content {
+		t.Errorf("nil options: got %q %q (expected %q %q)", art.Headline, art.Content, expected.Headline, expected.Content)
+	}
+
+	// changing the defaults mustn't affect anyone else
+	opts := DefaultOptions()
+	opts.Comments = true
+	if DefaultOptions().Comments {
+		t.Errorf("DefaultOptions() was modified")
+	}
+}
+
+func TestContentPass(t *testing.T) {
+	para := testPara("")
+	testData := []struct {
+		class    string
+		opts     *Options
+		expected string
+	}{
+		{"story", nil, "stripunlikelys+weightclasses+landmarks"},
+		{"story", &Options{NoLandmarks: true}, "stripunlikelys+weightclasses"},
+		// looks unlikely, so needs a relaxed pass
+		{"post has-comments", nil, "weightclasses+landmarks"},
+	}
+	for _, dat := range testData {
+		src := `<html><head><title>Foxes and dogs</title></head><body><h1>Foxes and dogs</h1><div class="` + dat.class + `">` +
+			para + para + para + `</div></body></html>`
+		art, err := ExtractFromHTMLWithOptions([]byte(src), "http://example.com/news/foxes-and-dogs", dat.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if art.ContentPass != dat.expected {
+			t.Errorf("%q: ContentPass = %q (expected %q)", dat.class, art.ContentPass, dat.expected)
+		}
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"github.com/bcampbell/arts/util"
+	"github.com/bcampbell/fuzzytime"
 	"golang.org/x/net/html"
 	"golang.org/x/net/html/charset"
 	"io"
@@ -37,14 +39,82 @@ type Publication struct {
 	// eg "article:publisher", rel-publisher
 }
 
+// Image is a picture within the article content
+type Image struct {
+	URL     string `json:"url"`
+	Alt     string `json:"alt,omitempty"`
+	Caption string `json:"caption,omitempty"`
+	Credit  string `json:"credit,omitempty"`
+}
+
+// LiveEntry is a single timestamped entry in a live blog.
+type LiveEntry struct {
+	Published string   `json:"published,omitempty"`
+	Headline  string   `json:"headline,omitempty"`
+	Authors   []Author `json:"authors,omitempty"`
+	Content   string   `json:"content,omitempty"`
+}
+
+// Link is a link within the article content
+type Link struct {
+	URL  string `json:"url"`
+	Text string `json:"text,omitempty"`
+	// External is set for links to other sites
+	External bool `json:"external,omitempty"`
+	// Position is the index of the block (in Article.Blocks) holding the
+	// link, counting from 0
+	Position int `json:"position"`
+}
+
+// Comment is a reader comment, along with any replies to it.
+type Comment struct {
+	Author    string    `json:"author,omitempty"`
+	Published string    `json:"published,omitempty"`
+	Text      string    `json:"text"`
+	Replies   []Comment `json:"replies,omitempty"`
+}
+
+// Quote is a direct quotation within the article content
+type Quote struct {
+	// Speaker is who said it (if known)
+	Speaker string `json:"speaker,omitempty"`
+	Text    string `json:"text"`
+	// Position is the index of the block (in Article.Blocks) holding the
+	// quote, counting from 0
+	Position int `json:"position"`
+}
+
 type Article struct {
 	CanonicalURL string `json:"canonical_url,omitempty"`
 	// all known URLs for article (including canonical)
 	// TODO: first url should be considered "preferred" if no canonical?
-	URLs     []string `json:"urls,omitempty"`
+	URLs []string `json:"urls,omitempty"`
+	// AMPURL is the url of the AMP version of the article, if any.
+	// (also included in URLs)
+	AMPURL   string   `json:"amp_url,omitempty"`
 	Headline string   `json:"headline,omitempty"`
 	Authors  []Author `json:"authors,omitempty"`
 	Content  string   `json:"content,omitempty"`
+	// ContentPass lists the content extraction settings used by the pass
+	// which found the Content. The first (strictest) pass uses
+	// "stripunlikelys+weightclasses+landmarks" (less "landmarks" if
+	// Options.NoLandmarks is set), and each relaxed pass drops another
+	// setting, down to "none".
+	ContentPass string `json:"content_pass,omitempty"`
+	// Images holds the pictures in the content, with captions and credits
+	Images []Image `json:"images,omitempty"`
+	// Links holds the links in the content, in order
+	Links []Link `json:"links,omitempty"`
+	// Blocks holds the content split up into paragraphs, headings etc
+	// (only filled out if Options.Blocks is set)
+	Blocks []Block `json:"blocks,omitempty"`
+	// Quotes holds the direct quotations in the content, in order
+	// (only filled out if Options.Quotes is set)
+	Quotes []Quote `json:"quotes,omitempty"`
+	// Entities holds the people, organisations and places mentioned in the
+	// content, most-mentioned first (only filled out if Options.Entities
+	// is set)
+	Entities []Entity `json:"entities,omitempty"`
 	// Published contains date of publication.
 	// An ISO8601 string is used instead of time.Time, so that
 	// less-precise representations can be held (eg YYYY-MM)
@@ -53,6 +123,12 @@ type Article struct {
 	Publication Publication `json:"publication,omitempty"`
 	Keywords    []Keyword   `json:"keywords,omitempty"`
 	Section     string      `json:"section,omitempty"`
+	// LiveEntries holds the individual entries if the article is a live
+	// blog (in page order).
+	LiveEntries []LiveEntry `json:"live_entries,omitempty"`
+	// Comments holds any reader comments (only filled out if
+	// Options.Comments is set).
+	Comments []Comment `json:"comments,omitempty"`
 	// TODO:
 	// Language
 	// article confidence?
@@ -68,6 +144,44 @@ func (art *Article) BestURL() string {
 	return ""
 }
 
+// Options controls the optional parts of the extraction.
+type Options struct {
+	// StripCaptions removes image captions and photo credits from Content.
+	// (they're still available via Article.Images)
+	StripCaptions bool
+	// URLRules are used to canonicalise the article urls.
+	// If nil, util.DefaultCanonicaliser is used.
+	URLRules *util.Canonicaliser
+	// NoLandmarks turns off the use of html5/aria landmarks (<main>, <nav>,
+	// role="complementary" etc) in the content extraction, for sites with
+	// misleading markup. (The pages in testdata/landmarks are run with and
+	// without, to check landmarks help)
+	NoLandmarks bool
+	// Policy controls which elements and attributes are kept in the Content.
+	// If nil, DefaultPolicy() is used.
+	Policy *SanitisePolicy
+	// Blocks splits the content up into Article.Blocks
+	Blocks bool
+	// Quotes extracts direct quotations (and who said them) from the
+	// content into Article.Quotes
+	Quotes bool
+	// Entities extracts the people, organisations and places mentioned in
+	// the content into Article.Entities
+	Entities bool
+	// Gazetteer lists known entities for the extraction.
+	// If nil, DefaultGazetteer is used.
+	Gazetteer *Gazetteer
+	// Comments extracts reader comments into Article.Comments.
+	// (comments are never included in the Content or Authors either way)
+	Comments bool
+}
+
+// DefaultOptions returns the options used by ExtractFromHTML() and
+// ExtractFromTree(). It's a fresh copy each time, so it's safe to modify.
+func DefaultOptions() *Options {
+	return &Options{}
+}
+
 // TODO:
 // - detect non-article pages (index pages etc)
 
@@ -96,6 +210,18 @@ var Debug = struct {
 
 	// CruftLogger is where debug output from cruft classification will be sent (adverts/social/sidebars etc)
 	CruftLogger *log.Logger
+
+	// LiveBlogLogger is where debug output from liveblog entry extraction will be sent
+	LiveBlogLogger *log.Logger
+
+	// CommentsLogger is where debug output from reader comment extraction will be sent
+	CommentsLogger *log.Logger
+
+	// QuotesLogger is where debug output from quote extraction will be sent
+	QuotesLogger *log.Logger
+
+	// EntitiesLogger is where debug output from entity extraction will be sent
+	EntitiesLogger *log.Logger
 }{
 	nullLogger,
 	nullLogger,
@@ -103,6 +229,10 @@ var Debug = struct {
 	nullLogger,
 	nullLogger,
 	nullLogger,
+	nullLogger,
+	nullLogger,
+	nullLogger,
+	nullLogger,
 }
 
 // delete this and leave it up to user?
@@ -144,16 +274,31 @@ func ParseHTML(rawHTML []byte) (*html.Node, error) {
 }
 
 func ExtractFromHTML(rawHTML []byte, artURL string) (*Article, error) {
+	return ExtractFromHTMLWithOptions(rawHTML, artURL, DefaultOptions())
+}
+
+// ExtractFromHTMLWithOptions is like ExtractFromHTML, but with control over
+// the optional parts of the extraction. A nil opts means DefaultOptions().
+func ExtractFromHTMLWithOptions(rawHTML []byte, artURL string, opts *Options) (*Article, error) {
 
 	root, err := ParseHTML(rawHTML)
 	if err != nil {
 		return nil, err
 	}
 
-	return ExtractFromTree(root, artURL)
+	return ExtractFromTreeWithOptions(root, artURL, opts)
 }
 
 func ExtractFromTree(root *html.Node, artURL string) (*Article, error) {
+	return ExtractFromTreeWithOptions(root, artURL, DefaultOptions())
+}
+
+// ExtractFromTreeWithOptions is like ExtractFromTree, but with control over
+// the optional parts of the extraction. A nil opts means DefaultOptions().
+func ExtractFromTreeWithOptions(root *html.Node, artURL string, opts *Options) (*Article, error) {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
 
 	art := &Article{}
 
@@ -171,7 +316,24 @@ func ExtractFromTree(root *html.Node, artURL string) (*Article, error) {
 	scriptNodes := removeScripts(root)
 
 	// extract any canonical or alternate urls
-	art.CanonicalURL, art.URLs = grabURLs(root, u)
+	canon := opts.URLRules
+	if canon == nil {
+		canon = &util.DefaultCanonicaliser
+	}
+	art.CanonicalURL, art.URLs = grabURLs(root, u, canon)
+	art.AMPURL = grabAMPURL(root, u, canon)
+	if art.AMPURL != "" {
+		got := false
+		for _, existing := range art.URLs {
+			if existing == art.AMPURL {
+				got = true
+				break
+			}
+		}
+		if !got {
+			art.URLs = append(art.URLs, art.AMPURL)
+		}
+	}
 	if art.CanonicalURL != "" {
 		artURL = art.CanonicalURL
 	}
@@ -184,11 +346,40 @@ func ExtractFromTree(root *html.Node, artURL string) (*Article, error) {
 		art.Headline = headline
 	}
 
-	contentNodes, contentScores := grabContent(root)
-	cruftBlocks := findCruft(root, contentScores, Debug.CruftLogger)
+	// cut out the reader comments, so they can't get mixed up with the
+	// article proper
+	commentSections := findCommentSections(root, headlineNode)
+	if opts.Comments {
+		art.Comments = grabComments(commentSections)
+	}
+	zapNodes(commentSections)
+
+	policy := opts.Policy
+	if policy == nil {
+		policy = &defaultPolicy
+	}
+
+	contentFlags := defaultContentFlags
+	if opts.NoLandmarks {
+		contentFlags &^= flagLandmarks
+	}
+	contentNodes, contentScores, contentFlags := grabContent(root, contentFlags)
+	art.ContentPass = contentFlags.String()
+	cruftBlocks := findCruft(root, u, contentScores, Debug.CruftLogger)
 	art.Authors = grabAuthors(root, contentNodes, headlineNode, cruftBlocks)
 
 	published, updated := grabDates(root, u, contentNodes, headlineNode, scriptNodes, cruftBlocks)
+
+	// for liveblogs, the entries give us better dates
+	liveEntries, first, latest := grabLiveEntries(root, scriptNodes, cruftBlocks, published, policy)
+	if len(liveEntries) > 0 {
+		art.LiveEntries = liveEntries
+		published = first
+		updated = fuzzytime.DateTime{}
+		if latest.ISOFormat() != first.ISOFormat() {
+			updated = latest
+		}
+	}
 	if !published.Empty() {
 		art.Published = published.ISOFormat()
 	}
@@ -202,8 +393,41 @@ func ExtractFromTree(root *html.Node, artURL string) (*Article, error) {
 			cruft.Parent.RemoveChild(cruft)
 		}
 	}
-	removeCruft(contentNodes, contentScores)
-	contentNodes = sanitiseContent(contentNodes)
+
+	// urls in the content are made absolute
+	baseURL := contentBaseURL(root, u, art.CanonicalURL)
+
+	images, captionNodes := grabImages(contentNodes, baseURL)
+	art.Images = images
+	if opts.StripCaptions {
+		for _, n := range captionNodes {
+			if n.Parent != nil {
+				n.Parent.RemoveChild(n)
+			}
+		}
+	}
+
+	removeCruft(contentNodes, contentScores, contentFlags, policy)
+	contentNodes = sanitiseContent(contentNodes, baseURL, policy)
+	siteURL := baseURL
+	if canonical, err := url.Parse(art.CanonicalURL); err == nil && canonical.IsAbs() {
+		siteURL = canonical
+	}
+	blocks := splitBlocks(contentNodes)
+	art.Links = grabLinks(contentNodes, blocks, siteURL)
+	if opts.Blocks {
+		art.Blocks = grabBlocks(blocks)
+	}
+	if opts.Quotes {
+		art.Quotes = grabQuotes(blocks)
+	}
+	if opts.Entities {
+		gaz := opts.Gazetteer
+		if gaz == nil {
+			gaz = DefaultGazetteer
+		}
+		art.Entities = grabEntities(blocks, gaz)
+	}
 
 	var out bytes.Buffer
 	for _, node := range contentNodes {
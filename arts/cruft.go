@@ -5,13 +5,17 @@ package arts
 // - sidebars
 // - related-articles
 // - social media share buttons
+// - "read more" blocks embedded in the article text
+// - newsletter signups and subscription/paywall prompts
+// - cookie/consent banners
 
 import (
 	//	"fmt"
 	"github.com/andybalholm/cascadia"
 	"golang.org/x/net/html"
-	//	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html/atom"
 	"log"
+	"net/url"
 	"regexp"
 	"strings"
 )
@@ -23,6 +27,17 @@ var cruftPats = struct {
 	likelyShareItemPat      *regexp.Regexp
 	cruftIndicative         *regexp.Regexp
 	shareLinkIndicative     []string
+	promoSel                cascadia.Selector
+	promoIndicative         *regexp.Regexp
+	articlePathPat          *regexp.Regexp
+	blockSel                cascadia.Selector
+	emailInputSel           cascadia.Selector
+	formSel                 cascadia.Selector
+	subscribeText           *regexp.Regexp
+	consentText             *regexp.Regexp
+	consentIndicative       *regexp.Regexp
+	adLabel                 *regexp.Regexp
+	adIndicative            *regexp.Regexp
 }{
 	cascadia.MustCompile("ul,div,section,aside"),
 	cascadia.MustCompile("a"),
@@ -30,9 +45,41 @@ var cruftPats = struct {
 	regexp.MustCompile(`(?i)twitter|google|gplus|googleplus|facebook|linkedin|whatsapp`),
 	regexp.MustCompile(`(?i)\b(?:combx|comment|community|departments|disqus|livefyre|remark|rss|shoutbox|sidebar|sponsor|ad-break|agegate|pagination|pager|popup|promo|rhs|sidebar|sponsor|shopping|tweet|twitter|facebook|trending|relatedarticles|shareboxes-wrapper)\b`),
 	[]string{"plus.google.com", "facebook.com", "twitter.com", "pinterest.com", "linkedin.com", "mailto:", "whatsapp:"},
+	cascadia.MustCompile("p,div,section,aside,ul,ol,h2,h3,h4,h5,h6"),
+	// text which introduces a block of links to other articles
+	// (en, fr, de, es, it, nl, sv, no, da, pt)
+	regexp.MustCompile(`(?i)^\s*(?:read more|read next|more on this(?: story)?|more from|related(?: articles| stories| content| links)?|see also|you may also like|recommended(?: for you)?|most read|lire aussi|à lire aussi|a lire aussi|voir aussi|lesen sie auch|mehr zum thema|leer más|lea también|te puede interesar|leggi anche|lees ook|läs också|les også|læs også|leia também)\b`),
+	// paths which look like they could be articles (slug or numeric id)
+	regexp.MustCompile(`(?i)(?:[a-z0-9]+-){2,}[a-z0-9]+|\d{4,}`),
+	cascadia.MustCompile("div,section,aside,p,form,dialog,figure"),
+	cascadia.MustCompile(`input[type="email"], input[name*="email"]`),
+	cascadia.MustCompile("form"),
+	// newsletter signup/subscription call-to-action text
+	regexp.MustCompile(`(?i)sign[ -]?up (?:to|for) (?:our|the|my)\b.{0,40}\bnewsletters?|newsletter sign[ -]?up|get (?:our|the) .{0,40}newsletter|subscribe to (?:continue|keep) reading|subscribe (?:now|today) (?:to|for)|to continue reading|already a subscriber|(?:reached|used up) your (?:free )?(?:article|story) limit|(?:article|content) is (?:only )?(?:for|available to) subscribers|register to (?:continue|read)`),
+	// cookie/consent text
+	regexp.MustCompile(`(?i)(?:we|this (?:site|website)) uses? cookies|cookie (?:policy|settings|preferences)|by continuing to (?:use|browse)|manage (?:your )?(?:consent|privacy)|accept (?:all )?cookies|we value your privacy`),
+	regexp.MustCompile(`(?i)cookie|consent|gdpr|\bcmp\b|cmp-|privacy-?banner`),
+	// "advertisement" labels (en, de, fr, es, it, nl, sv, da/no)
+	regexp.MustCompile(`(?i)^\s*(?:advertisement|advert|ad|sponsored|anzeige|werbung|publicité|publicidad|pubblicità|advertentie|annons|annonse|reklame)\s*$`),
+	// advert class/id. "ad" has to be a whole token, the rest can be part
+	// of a hyphenated one ("ad-slot", "sidebar-mpu")
+	regexp.MustCompile(`(?i)(?:^|\s)ad(?:\s|$)|(?:^|[\s_-])(?:ads|advert|adverts|advertisement|adslot|adunit|dfp|mpu|ad[-_](?:slot|unit|container|wrapper|banner)|gpt-ad|google-ad)(?:[\s_-]|$)`),
 }
 
-func findCruft(root *html.Node, contentNodes candidateMap, dbug *log.Logger) []*html.Node {
+// contentScoreWithin adds up the content scores of all the nodes inside el.
+// Cruft blocks are unlikely to contain significant content, so candidates
+// are penalised by this amount.
+func contentScoreWithin(el *html.Node, contentNodes candidateMap) float64 {
+	contentScore := 0.0
+	for n, score := range contentNodes {
+		if contains(el, n) {
+			contentScore += score.total()
+		}
+	}
+	return contentScore
+}
+
+func findCruft(root *html.Node, baseURL *url.URL, contentNodes candidateMap, dbug *log.Logger) []*html.Node {
 	candidates := candidateList{}
 	// look for likely ul or div blocks
 	for _, el := range cruftPats.shareContainerSel.MatchAll(root) {
@@ -44,12 +91,7 @@ func findCruft(root *html.Node, contentNodes candidateMap, dbug *log.Logger) []*
 			c.addPoints(3, "cruft indicative")
 
 			// cruft blocks are unlikely to contain significant content...
-			contentScore := 0.0
-			for n, score := range contentNodes {
-				if contains(el, n) {
-					contentScore += score.total()
-				}
-			}
+			contentScore := contentScoreWithin(el, contentNodes)
 			if contentScore > 0 {
 				c.addPoints(-contentScore, "contains content")
 			}
@@ -78,9 +120,176 @@ func findCruft(root *html.Node, contentNodes candidateMap, dbug *log.Logger) []*
 	for _, c := range social {
 		cruft = append(cruft, c.node())
 	}
+
+	families := []struct {
+		name       string
+		candidates candidateList
+	}{
+		{"inline promo blocks", findInlinePromoBlocks(root, baseURL, contentNodes)},
+		{"newsletter signups", findNewsletterBlocks(root, contentNodes)},
+		{"subscription prompts", findSubscriptionPrompts(root, contentNodes)},
+		{"consent dialogs", findConsentBlocks(root, contentNodes)},
+		{"advertisement slots", findAdSlots(root, contentNodes)},
+	}
+	for _, family := range families {
+		dbug.Printf("%s: %d candidates\n", family.name, len(family.candidates))
+		for _, c := range family.candidates {
+			c.dump(dbug)
+			cruft = append(cruft, c.node())
+		}
+	}
 	return cruft
 }
 
+// cullCruftCandidates applies the content-score penalty, drops any
+// candidates scoring below threshold and any nested within other
+// candidates. Returns the survivors sorted by score.
+func cullCruftCandidates(candidates candidateList, contentNodes candidateMap, threshold float64) candidateList {
+	for _, c := range candidates {
+		contentScore := contentScoreWithin(c.node(), contentNodes)
+		if contentScore > 0 {
+			c.addPoints(-contentScore, "contains content")
+		}
+	}
+
+	candidates = candidates.Filter(func(c candidate) bool {
+		return c.total() >= threshold
+	})
+	candidates = candidates.Filter(func(c candidate) bool {
+		for _, outer := range candidates {
+			if contains(outer.node(), c.node()) {
+				return false
+			}
+		}
+		return true
+	})
+	candidates.Sort()
+	return candidates
+}
+
+// growCruftBlock expands el out to the largest enclosing element with
+// no more than maxLen chars of text, stopping short of any content.
+// Used to catch the whole of a box (heading, blurb, form etc) when we've
+// only spotted part of it.
+func growCruftBlock(el *html.Node, maxLen int, contentNodes candidateMap) *html.Node {
+	for el.Parent != nil && el.Parent.Type == html.ElementNode && el.Parent.DataAtom != atom.Body {
+		parent := el.Parent
+		if len(compressSpace(getTextContent(parent))) > maxLen {
+			break
+		}
+		if _, isContent := contentNodes[parent]; isContent {
+			break
+		}
+		el = parent
+	}
+	return el
+}
+
+// findInlinePromoBlocks looks for "read more" or "related articles" blocks
+// embedded within the article text. These are usually some indicative text
+// followed by one or more links to other articles on the same site, eg:
+//
+//	<p><strong>READ MORE:</strong></p>
+//	<p><a href="/news/1234/other-story">Some other story</a></p>
+//
+// or
+//
+//	<p>Read more: <a href="/news/1234/other-story">Some other story</a></p>
+func findInlinePromoBlocks(root *html.Node, baseURL *url.URL, contentNodes candidateMap) candidateList {
+	candidates := candidateList{}
+	got := map[*html.Node]candidate{}
+	add := func(el *html.Node) candidate {
+		if c, ok := got[el]; ok {
+			return c
+		}
+		c := newStandardCandidate(el, snip(compressSpace(getTextContent(el)), 40))
+		got[el] = c
+		candidates = append(candidates, c)
+		return c
+	}
+
+	for _, el := range cruftPats.promoSel.MatchAll(root) {
+		txt := compressSpace(getTextContent(el))
+		if !cruftPats.promoIndicative.MatchString(txt) {
+			continue
+		}
+		if linkOnly(el) || (len(txt) < 200 && getLinkDensity(el) >= 0.5) {
+			// the indicative text and the links are all in one block
+			c := add(el)
+			c.addPoints(3, "indicative text")
+			c.addPoints(2, "mostly links")
+			continue
+		}
+		if len(txt) > 40 {
+			// too long for a label - probably just a paragraph which
+			// happens to start with "related..."
+			continue
+		}
+		// a label - the links should follow it
+		c := add(el)
+		c.addPoints(3, "indicative text")
+		for sib := el.NextSibling; sib != nil; sib = sib.NextSibling {
+			if sib.Type == html.TextNode && strings.TrimSpace(sib.Data) == "" {
+				continue
+			}
+			if sib.Type != html.ElementNode || !linkOnly(sib) {
+				break
+			}
+			c2 := add(sib)
+			c2.addPoints(3, "follows indicative text")
+			c2.addPoints(2, "mostly links")
+		}
+	}
+
+	// lists of headlines linking to other articles on the same site
+	for _, el := range cruftPats.promoSel.MatchAll(root) {
+		if el.DataAtom != atom.Ul && el.DataAtom != atom.Ol {
+			continue
+		}
+		if !linkOnly(el) {
+			continue
+		}
+		cnt := 0
+		bad := false
+		for _, a := range cruftPats.linkSel.MatchAll(el) {
+			if !isSameSiteArticleLink(a, baseURL) || wordCount(getTextContent(a)) < 4 {
+				bad = true
+				break
+			}
+			cnt++
+		}
+		if bad || cnt < 2 {
+			continue
+		}
+		c := add(el)
+		c.addPoints(2, "list of same-site headlines")
+		c.addPoints(1, "all links")
+	}
+
+	return cullCruftCandidates(candidates, contentNodes, 3)
+}
+
+// linkOnly returns true if the element contains links and little else
+func linkOnly(el *html.Node) bool {
+	if cruftPats.linkSel.MatchFirst(el) == nil {
+		return false
+	}
+	return getLinkDensity(el) >= 0.9
+}
+
+// isSameSiteArticleLink returns true if <a> links to what looks like
+// another article on the same site as baseURL
+func isSameSiteArticleLink(a *html.Node, baseURL *url.URL) bool {
+	u, err := baseURL.Parse(getAttr(a, "href"))
+	if err != nil {
+		return false
+	}
+	if strings.TrimPrefix(strings.ToLower(u.Host), "www.") != strings.TrimPrefix(strings.ToLower(baseURL.Host), "www.") {
+		return false
+	}
+	return cruftPats.articlePathPat.MatchString(u.Path)
+}
+
 func findSocialMediaShareBlocks(root *html.Node, dbug *log.Logger) candidateList {
 
 	candidates := candidateList{}
@@ -126,3 +335,188 @@ func findSocialMediaShareBlocks(root *html.Node, dbug *log.Logger) candidateList
 	candidates.Sort()
 	return candidates
 }
+
+// findNewsletterBlocks looks for email signup forms (and the boxes
+// they live in)
+func findNewsletterBlocks(root *html.Node, contentNodes candidateMap) candidateList {
+	candidates := candidateList{}
+	for _, input := range cruftPats.emailInputSel.MatchAll(root) {
+		el := input
+		if form := closest(input, cruftPats.formSel); form != nil {
+			el = form
+		}
+		el = growCruftBlock(el, 300, contentNodes)
+		c := newStandardCandidate(el, snip(compressSpace(getTextContent(el)), 40))
+		c.addPoints(2, "email input")
+		if cruftPats.subscribeText.MatchString(getTextContent(el)) {
+			c.addPoints(2, "signup text")
+		}
+		if strings.Contains(strings.ToLower(getAttr(el, "class")+" "+getAttr(el, "id")), "newsletter") {
+			c.addPoints(1, "newsletter class/id")
+		}
+		candidates = append(candidates, c)
+	}
+	return cullCruftCandidates(candidates, contentNodes, 3)
+}
+
+// topContentNode returns the highest-scoring content candidate (or nil)
+func topContentNode(contentNodes candidateMap) *html.Node {
+	var top candidate
+	for _, c := range contentNodes {
+		if top == nil || c.total() > top.total() {
+			top = c
+		}
+	}
+	if top == nil {
+		return nil
+	}
+	return top.node()
+}
+
+// holdsBodyText returns true if el is (or contains) part of the article
+// text proper - a paragraph directly within the top content candidate.
+// The text-based detectors mustn't remove those, however much they
+// sound like a call-to-action or a cookie notice.
+func holdsBodyText(el *html.Node, top *html.Node) bool {
+	if top == nil {
+		return false
+	}
+	return el == top || contains(el, top) || (el.Parent == top && el.DataAtom == atom.P)
+}
+
+// growTextBlock is like growCruftBlock, for the text-based detectors.
+// A short call-to-action or cookie notice can be scored as content in
+// its own right, so it only stops short of the top content candidate.
+func growTextBlock(el *html.Node, maxLen int, top *html.Node) *html.Node {
+	for el.Parent != nil && el.Parent.Type == html.ElementNode && el.Parent.DataAtom != atom.Body {
+		parent := el.Parent
+		if parent == top || len(compressSpace(getTextContent(parent))) > maxLen {
+			break
+		}
+		el = parent
+	}
+	return el
+}
+
+// leafBlocks returns the elements matching sel which don't contain any
+// others. The text-based detectors only look at these, so each bit of
+// text is only examined once (rather than once per enclosing block).
+func leafBlocks(root *html.Node, sel cascadia.Selector) []*html.Node {
+	all := sel.MatchAll(root)
+	outer := map[*html.Node]bool{}
+	for _, el := range all {
+		for n := el.Parent; n != nil; n = n.Parent {
+			if sel.Match(n) {
+				outer[n] = true
+				break
+			}
+		}
+	}
+	leaves := []*html.Node{}
+	for _, el := range all {
+		if !outer[el] {
+			leaves = append(leaves, el)
+		}
+	}
+	return leaves
+}
+
+// findSubscriptionPrompts looks for "subscribe to continue reading" and
+// "sign up to our newsletter" calls-to-action
+func findSubscriptionPrompts(root *html.Node, contentNodes candidateMap) candidateList {
+	candidates := candidateList{}
+	got := map[*html.Node]struct{}{}
+	top := topContentNode(contentNodes)
+	for _, el := range leafBlocks(root, cruftPats.blockSel) {
+		txt := compressSpace(getTextContent(el))
+		if len(txt) > 300 || !cruftPats.subscribeText.MatchString(txt) {
+			continue
+		}
+		if holdsBodyText(el, top) {
+			continue
+		}
+		el = growTextBlock(el, 300, top)
+		if _, seen := got[el]; seen {
+			continue
+		}
+		got[el] = struct{}{}
+		c := newStandardCandidate(el, snip(txt, 40))
+		c.addPoints(3, "subscription call-to-action text")
+		candidates = append(candidates, c)
+	}
+	return cullCruftCandidates(candidates, contentNodes, 3)
+}
+
+// findConsentBlocks looks for cookie banners and GDPR consent dialogs
+func findConsentBlocks(root *html.Node, contentNodes candidateMap) candidateList {
+	candidates := candidateList{}
+	got := map[*html.Node]candidate{}
+	add := func(el *html.Node) candidate {
+		if c, ok := got[el]; ok {
+			return c
+		}
+		c := newStandardCandidate(el, snip(compressSpace(getTextContent(el)), 40))
+		got[el] = c
+		candidates = append(candidates, c)
+		return c
+	}
+
+	for _, el := range cruftPats.blockSel.MatchAll(root) {
+		if cruftPats.consentIndicative.MatchString(getAttr(el, "class")) ||
+			cruftPats.consentIndicative.MatchString(getAttr(el, "id")) {
+			add(el).addPoints(2, "consent class/id")
+		}
+		if getAttr(el, "role") == "dialog" || getAttr(el, "aria-modal") == "true" || el.DataAtom == atom.Dialog {
+			add(el).addPoints(1, "dialog")
+		}
+	}
+
+	top := topContentNode(contentNodes)
+	for _, el := range leafBlocks(root, cruftPats.blockSel) {
+		txt := compressSpace(getTextContent(el))
+		if !cruftPats.consentText.MatchString(txt) || holdsBodyText(el, top) {
+			continue
+		}
+		c := add(growTextBlock(el, 500, top))
+		c.addPoints(2, "consent text")
+		if len(txt) < 500 {
+			c.addPoints(1, "short")
+		}
+	}
+	return cullCruftCandidates(candidates, contentNodes, 3)
+}
+
+// findAdSlots looks for advertisement slots, either by class/id or by an
+// "Advertisement" label
+func findAdSlots(root *html.Node, contentNodes candidateMap) candidateList {
+	candidates := candidateList{}
+	got := map[*html.Node]candidate{}
+	add := func(el *html.Node) candidate {
+		if c, ok := got[el]; ok {
+			return c
+		}
+		c := newStandardCandidate(el, snip(compressSpace(getTextContent(el)), 40))
+		got[el] = c
+		candidates = append(candidates, c)
+		return c
+	}
+
+	for _, el := range cruftPats.shareContainerSel.MatchAll(root) {
+		txt := compressSpace(getTextContent(el))
+		if cruftPats.adLabel.MatchString(txt) {
+			// the label and whatever empty slot it's labelling
+			c := add(growCruftBlock(el, len(txt), contentNodes))
+			c.addPoints(3, "advertisement label")
+			continue
+		}
+		if cruftPats.adIndicative.MatchString(getAttr(el, "class")) ||
+			cruftPats.adIndicative.MatchString(getAttr(el, "id")) {
+			c := add(el)
+			c.addPoints(2, "advert class/id")
+			if len(txt) < 100 {
+				c.addPoints(1, "little text")
+			}
+		}
+	}
+	return cullCruftCandidates(candidates, contentNodes, 3)
+}
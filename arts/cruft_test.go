@@ -0,0 +1,116 @@
+package arts
+
+import (
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+	"net/url"
+	"testing"
+)
+
+// checkCruft runs findCruft() over some html and checks that the elements
+// with class "cruft" (and only those) are flagged.
+func checkCruft(t *testing.T, name string, src string) {
+	root := parseDoc(src)
+	baseURL, _ := url.Parse("http://example.com/news/1234/some-story")
+	_, contentScores, _ := grabContent(root, defaultContentFlags)
+	cruft := findCruft(root, baseURL, contentScores, nullLogger)
+
+	expected := cascadia.MustCompile(".cruft").MatchAll(root)
+	isCruft := func(n *html.Node) bool {
+		for _, c := range cruft {
+			if c == n || contains(c, n) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, n := range expected {
+		if !isCruft(n) {
+			t.Errorf("%s: %s not identified as cruft", name, describeNode(n))
+		}
+	}
+	for _, n := range cascadia.MustCompile(".content").MatchAll(root) {
+		if isCruft(n) {
+			t.Errorf("%s: %s wrongly identified as cruft", name, describeNode(n))
+		}
+	}
+}
+
+func TestInlinePromoCruft(t *testing.T) {
+	para := `<p class="content">` + testParaText + `</p>`
+
+	checkCruft(t, "label then links", `<html><body><div class="article">`+para+para+
+		`<p class="cruft"><strong>READ MORE:</strong></p>
+<p class="cruft"><a href="/news/555/another-thing-happened">Another thing happened</a></p>
+<p class="cruft"><a href="/news/556/yet-another-thing">Yet another thing</a></p>`+para+para+`</div></body></html>`)
+
+	checkCruft(t, "inline", `<html><body><div class="article">`+para+para+
+		`<p class="cruft">Read more: <a href="/news/555/another-thing-happened">Another thing happened to someone</a></p>`+para+para+`</div></body></html>`)
+
+	checkCruft(t, "non-english", `<html><body><div class="article">`+para+para+
+		`<p class="cruft">Lesen Sie auch: <a href="/news/555/another-thing-happened">Ein anderes Ding</a></p>`+para+para+`</div></body></html>`)
+
+	checkCruft(t, "headline list", `<html><body><div class="article">`+para+para+
+		`<ul class="cruft">
+<li><a href="/news/555/another-thing-happened">Another thing happened to someone</a></li>
+<li><a href="/news/556/yet-another-thing">Yet another thing happened today</a></li>
+</ul>`+para+para+`</div></body></html>`)
+
+	checkCruft(t, "not a label", `<html><body><div class="article">`+para+
+		`<p class="content">Related to this, the fox went on to jump over quite a few other dogs, <a href="/foo">as reported</a> at the time.</p>`+para+`</div></body></html>`)
+}
+
+func TestSignupConsentAdCruft(t *testing.T) {
+	para := `<p class="content">` + testParaText + `</p>`
+
+	checkCruft(t, "newsletter form", `<html><body><div class="article">`+para+para+
+		`<div class="cruft"><h3>Daily briefing</h3><p>Sign up to our daily newsletter</p>
+<form action="/signup"><input type="email" name="addr"><button>Go</button></form></div>`+para+para+`</div></body></html>`)
+
+	checkCruft(t, "paywall", `<html><body><div class="article">`+para+para+
+		`<div class="cruft"><p>Subscribe to continue reading.</p><p><a href="/subscribe">Subscribe</a></p></div>`+
+		`</div></body></html>`)
+
+	checkCruft(t, "cookie banner", `<html><body>
+<div id="cookie-notice" class="cruft"><p>We use cookies to improve your experience. <a href="/cookies">Find out more</a></p><button>Accept</button></div>
+<div class="article">`+para+para+para+`</div></body></html>`)
+
+	// article text which happens to sound like a call-to-action or a
+	// cookie notice should be left alone
+	checkCruft(t, "body text", `<html><body><div class="article">`+para+
+		`<p class="content">Only the most determined managed to continue reading after the first chapter, the critics said.</p>`+para+
+		`<p class="content">"We use cookies to keep the staff happy," the bakery owner joked, as the queue grew longer.</p>`+para+
+		`</div></body></html>`)
+
+	checkCruft(t, "ad label", `<html><body><div class="article">`+para+para+
+		`<div class="slot cruft"><span>Advertisement</span><div></div></div>`+para+para+`</div></body></html>`)
+}
+
+func TestAdIndicative(t *testing.T) {
+	testData := []struct {
+		class    string
+		expected bool
+	}{
+		{"ad", true},
+		{"sidebar ad top", true},
+		{"ads-container", true},
+		{"advert", true},
+		{"ad-slot-top", true},
+		{"inline_ad_unit", true},
+		{"gpt-ad-1234", true},
+		{"mpu", true},
+		{"sidebar-mpu", true},
+		{"ad-hoc-list", false},
+		{"head-ad-free", false},
+		{"compute-panel", false},
+		{"mpuzzle", false},
+		{"bad lead", false},
+		{"download-links", false},
+	}
+	for _, dat := range testData {
+		got := cruftPats.adIndicative.MatchString(dat.class)
+		if got != dat.expected {
+			t.Errorf("adIndicative(%q) = %v (expected %v)", dat.class, got, dat.expected)
+		}
+	}
+}
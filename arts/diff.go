@@ -0,0 +1,317 @@
+package arts
+
+// diff.go - comparing two extractions of the same article (eg to catch
+// stealth edits between scrapes).
+
+import (
+	"bytes"
+	"fmt"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"strings"
+)
+
+// ChangeKind says how a field or block differs between two versions
+type ChangeKind string
+
+const (
+	Added   ChangeKind = "added"
+	Removed ChangeKind = "removed"
+	Changed ChangeKind = "changed"
+)
+
+// FieldChange is a change to one of the article fields (headline, authors
+// etc). Lists (authors, keywords) are compared as a whole, and given as
+// "; "-separated strings.
+type FieldChange struct {
+	Field string     `json:"field"`
+	Kind  ChangeKind `json:"kind"`
+	Old   string     `json:"old,omitempty"`
+	New   string     `json:"new,omitempty"`
+}
+
+// BlockChange is a content block which was added, removed or changed.
+// OldIndex and NewIndex are the positions of the block in each version
+// (-1 for added or removed blocks).
+type BlockChange struct {
+	Kind     ChangeKind `json:"kind"`
+	OldIndex int        `json:"old_index"`
+	NewIndex int        `json:"new_index"`
+	Old      *Block     `json:"old,omitempty"`
+	New      *Block     `json:"new,omitempty"`
+}
+
+// ArticleDiff lists the differences between two versions of an article
+type ArticleDiff struct {
+	Fields []FieldChange `json:"fields,omitempty"`
+	Blocks []BlockChange `json:"blocks,omitempty"`
+}
+
+// Empty returns true if there are no differences
+func (d *ArticleDiff) Empty() bool {
+	return len(d.Fields) == 0 && len(d.Blocks) == 0
+}
+
+// minBlockSimilarity is how alike (jaccard index on words) a removed and
+// an added block need to be to count as the same block, changed
+const minBlockSimilarity = 0.5
+
+// DiffArticles compares two versions of an article, field-by-field and
+// then block-by-block through the content. If the articles don't have
+// Blocks (ie Options.Blocks wasn't set), they're worked out from Content.
+func DiffArticles(oldArt, newArt *Article) *ArticleDiff {
+	d := &ArticleDiff{Fields: []FieldChange{}, Blocks: []BlockChange{}}
+
+	oldFields := diffFields(oldArt)
+	newFields := diffFields(newArt)
+	for i, f := range oldFields {
+		oldVal, newVal := f[1], newFields[i][1]
+		if oldVal == newVal {
+			continue
+		}
+		c := FieldChange{Field: f[0], Kind: Changed, Old: oldVal, New: newVal}
+		if oldVal == "" {
+			c.Kind = Added
+		} else if newVal == "" {
+			c.Kind = Removed
+		}
+		d.Fields = append(d.Fields, c)
+	}
+
+	oldBlocks := articleBlocks(oldArt)
+	newBlocks := articleBlocks(newArt)
+	oldIDs := make([]string, len(oldBlocks))
+	for i, b := range oldBlocks {
+		oldIDs[i] = b.ID
+	}
+	newIDs := make([]string, len(newBlocks))
+	for i, b := range newBlocks {
+		newIDs[i] = b.ID
+	}
+
+	// between the matching blocks are runs of removed and added ones.
+	// Pair up similar blocks within each run as changes.
+	var removed, added []int
+	flush := func() {
+		j := 0
+		for _, oi := range removed {
+			match := -1
+			for k := j; k < len(added); k++ {
+				ob, nb := oldBlocks[oi], newBlocks[added[k]]
+				if ob.Kind == nb.Kind && jaccardWordCompare(ob.Text, nb.Text) >= minBlockSimilarity {
+					match = k
+					break
+				}
+			}
+			if match < 0 {
+				d.Blocks = append(d.Blocks, BlockChange{Kind: Removed, OldIndex: oi, NewIndex: -1, Old: &oldBlocks[oi]})
+				continue
+			}
+			for ; j < match; j++ {
+				d.Blocks = append(d.Blocks, BlockChange{Kind: Added, OldIndex: -1, NewIndex: added[j], New: &newBlocks[added[j]]})
+			}
+			ni := added[match]
+			d.Blocks = append(d.Blocks, BlockChange{Kind: Changed, OldIndex: oi, NewIndex: ni, Old: &oldBlocks[oi], New: &newBlocks[ni]})
+			j = match + 1
+		}
+		for ; j < len(added); j++ {
+			d.Blocks = append(d.Blocks, BlockChange{Kind: Added, OldIndex: -1, NewIndex: added[j], New: &newBlocks[added[j]]})
+		}
+		removed, added = nil, nil
+	}
+	for _, op := range diffStrings(oldIDs, newIDs) {
+		switch op.op {
+		case '-':
+			removed = append(removed, op.a)
+		case '+':
+			added = append(added, op.b)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return d
+}
+
+// UnifiedDiff returns a unified-format text diff between two versions of
+// an article (fields first, then the text of the content blocks).
+// Returns an empty string if there are no differences.
+func UnifiedDiff(oldArt, newArt *Article, oldName, newName string) string {
+	a := articleLines(oldArt)
+	b := articleLines(newArt)
+	ops := diffStrings(a, b)
+
+	const context = 3
+	var out bytes.Buffer
+	// find the ranges of ops to show, merging any which overlap
+	type hunk struct{ start, end int }
+	hunks := []hunk{}
+	for i, op := range ops {
+		if op.op == '=' {
+			continue
+		}
+		start, end := i-context, i+context+1
+		if start < 0 {
+			start = 0
+		}
+		if end > len(ops) {
+			end = len(ops)
+		}
+		if len(hunks) > 0 && start <= hunks[len(hunks)-1].end {
+			hunks[len(hunks)-1].end = end
+		} else {
+			hunks = append(hunks, hunk{start, end})
+		}
+	}
+	if len(hunks) == 0 {
+		return ""
+	}
+
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+	for _, h := range hunks {
+		oldCnt, newCnt := 0, 0
+		for _, op := range ops[h.start:h.end] {
+			if op.op != '+' {
+				oldCnt++
+			}
+			if op.op != '-' {
+				newCnt++
+			}
+		}
+		oldStart, newStart := ops[h.start].a, ops[h.start].b
+		if oldCnt > 0 {
+			oldStart++
+		}
+		if newCnt > 0 {
+			newStart++
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCnt, newStart, newCnt)
+		for _, op := range ops[h.start:h.end] {
+			switch op.op {
+			case '-':
+				fmt.Fprintf(&out, "-%s\n", a[op.a])
+			case '+':
+				fmt.Fprintf(&out, "+%s\n", b[op.b])
+			default:
+				fmt.Fprintf(&out, " %s\n", a[op.a])
+			}
+		}
+	}
+	return out.String()
+}
+
+// diffFields returns the (name, value) pairs of the fields to compare
+func diffFields(art *Article) [][2]string {
+	authors := []string{}
+	for _, a := range art.Authors {
+		authors = append(authors, a.Name)
+	}
+	keywords := []string{}
+	for _, kw := range art.Keywords {
+		keywords = append(keywords, kw.Name)
+	}
+	return [][2]string{
+		{"headline", art.Headline},
+		{"authors", strings.Join(authors, "; ")},
+		{"published", art.Published},
+		{"updated", art.Updated},
+		{"section", art.Section},
+		{"keywords", strings.Join(keywords, "; ")},
+	}
+}
+
+// articleBlocks returns the content blocks of an article, splitting up
+// the Content if Blocks isn't filled out.
+func articleBlocks(art *Article) []Block {
+	if len(art.Blocks) > 0 || art.Content == "" {
+		return art.Blocks
+	}
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(art.Content), body)
+	if err != nil {
+		return nil
+	}
+	return grabBlocks(splitBlocks(nodes))
+}
+
+// articleLines renders an article as lines of text, for UnifiedDiff
+func articleLines(art *Article) []string {
+	lines := []string{}
+	for _, f := range diffFields(art) {
+		lines = append(lines, f[0]+": "+f[1])
+	}
+	for _, b := range articleBlocks(art) {
+		prefix := ""
+		switch b.Kind {
+		case BlockHeading:
+			prefix = strings.Repeat("#", b.Level) + " "
+		case BlockList:
+			prefix = "- "
+		case BlockQuote:
+			prefix = "> "
+		case BlockFigure:
+			prefix = "[figure] "
+		case BlockEmbed:
+			prefix = "[embed] "
+		}
+		lines = append(lines, "")
+		for _, line := range strings.Split(b.Text, "\n") {
+			lines = append(lines, strings.TrimRight(prefix+line, " "))
+		}
+	}
+	return lines
+}
+
+// diffOp is a single step in an edit script: '=' (a[a] == b[b]),
+// '-' (remove a[a]) or '+' (insert b[b]). For removals b is the current
+// position in b, and for insertions a is the current position in a.
+type diffOp struct {
+	op   byte
+	a, b int
+}
+
+// diffStrings returns an edit script turning a into b, using the longest
+// common subsequence. Removals come before insertions.
+func diffStrings(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	// lcs[i][j] is the length of the LCS of a[i:] and b[j:]
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	ops := make([]diffOp, 0, n+m)
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{'=', i, j})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', i, j})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', i, j})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		ops = append(ops, diffOp{'-', i, j})
+	}
+	for ; j < m; j++ {
+		ops = append(ops, diffOp{'+', i, j})
+	}
+	return ops
+}
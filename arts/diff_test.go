@@ -0,0 +1,100 @@
+package arts
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiffArticles(t *testing.T) {
+	oldArt := &Article{
+		Headline: "Minister denies wrongdoing",
+		Authors:  []Author{{Name: "Fred Bloggs"}},
+		Section:  "Politics",
+		Content: `<p>The minister has denied any wrongdoing.</p>
+<p>He said the claims were false and would be fought in court.</p>
+<p>A spokesman declined to comment.</p>`,
+	}
+	newArt := &Article{
+		Headline: "Minister admits wrongdoing",
+		Authors:  []Author{{Name: "Fred Bloggs"}, {Name: "Jane Doe"}},
+		Content: `<p>The minister has denied any wrongdoing.</p>
+<p>He said the claims were false and would be fought in the courts.</p>
+<p>Opposition parties called for his resignation.</p>`,
+	}
+
+	d := DiffArticles(oldArt, newArt)
+
+	expectedFields := []FieldChange{
+		{"headline", Changed, "Minister denies wrongdoing", "Minister admits wrongdoing"},
+		{"authors", Changed, "Fred Bloggs", "Fred Bloggs; Jane Doe"},
+		{"section", Removed, "Politics", ""},
+	}
+	if len(d.Fields) != len(expectedFields) {
+		t.Fatalf("got %d field changes (expected %d): %v", len(d.Fields), len(expectedFields), d.Fields)
+	}
+	for i, expected := range expectedFields {
+		if d.Fields[i] != expected {
+			t.Errorf("field change %d: got %v (expected %v)", i, d.Fields[i], expected)
+		}
+	}
+
+	expectedBlocks := []struct {
+		kind     ChangeKind
+		oldIndex int
+		newIndex int
+	}{
+		{Changed, 1, 1},
+		{Removed, 2, -1},
+		{Added, -1, 2},
+	}
+	if len(d.Blocks) != len(expectedBlocks) {
+		t.Fatalf("got %d block changes (expected %d): %v", len(d.Blocks), len(expectedBlocks), d.Blocks)
+	}
+	for i, expected := range expectedBlocks {
+		got := d.Blocks[i]
+		if got.Kind != expected.kind || got.OldIndex != expected.oldIndex || got.NewIndex != expected.newIndex {
+			t.Errorf("block change %d: got %s %d=>%d (expected %s %d=>%d)", i,
+				got.Kind, got.OldIndex, got.NewIndex, expected.kind, expected.oldIndex, expected.newIndex)
+		}
+	}
+
+	if d := DiffArticles(oldArt, oldArt); !d.Empty() {
+		t.Errorf("expected no differences, got %v", d)
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	oldArt := &Article{
+		Headline: "Foxes",
+		Content:  `<h2>Quick</h2><p>The quick brown fox.</p><p>Jumps over the dog.</p>`,
+	}
+	newArt := &Article{
+		Headline: "Foxes",
+		Content:  `<h2>Quick</h2><p>The quick red fox.</p><p>Jumps over the dog.</p>`,
+	}
+
+	expected := strings.Join([]string{
+		"--- old",
+		"+++ new",
+		"@@ -7,6 +7,6 @@",
+		" ",
+		" ## Quick",
+		" ",
+		"-The quick brown fox.",
+		"+The quick red fox.",
+		" ",
+		" Jumps over the dog.",
+	}, "\n") + "\n"
+	got := UnifiedDiff(oldArt, newArt, "old", "new")
+	if got != expected {
+		t.Errorf("got:\n%s\nexpected:\n%s", got, expected)
+	}
+
+	if got := UnifiedDiff(oldArt, oldArt, "old", "new"); got != "" {
+		t.Errorf("expected empty diff, got:\n%s", got)
+	}
+
+	if !strings.Contains(UnifiedDiff(oldArt, &Article{}, "old", "new"), "-headline: Foxes\n+headline: \n") {
+		t.Errorf("expected headline change")
+	}
+}
@@ -0,0 +1,344 @@
+package arts
+
+// entities.go - finding the people, organisations and places mentioned in
+// the content.
+//
+// Nothing clever - runs of capitalised words are matched against the
+// gazetteer, then classified by the words they start or end with
+// ("University of...", "...Council", "...Street"), by titles ("Mr",
+// "President") and finally by the name patterns used for bylines.
+// Later mentions by surname alone ("Smith") are counted against the full
+// name ("John Smith").
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Mention is a single appearance of an entity in the content
+type Mention struct {
+	// Position is the index of the block holding the mention, counting
+	// from 0 (as for Links and Quotes)
+	Position int `json:"position"`
+	// Offset is the byte offset of the mention within the block's Text
+	Offset int `json:"offset"`
+	// Text is the mention as it appears (eg "Mr Smith")
+	Text string `json:"text"`
+}
+
+// Entity is a person, organisation or place mentioned in the content
+type Entity struct {
+	Name     string     `json:"name"`
+	Kind     EntityKind `json:"kind"`
+	Count    int        `json:"count"`
+	Mentions []Mention  `json:"mentions"`
+}
+
+var entityPats = struct {
+	wordPat       *regexp.Regexp
+	possessivePat *regexp.Regexp
+	orgHeads      map[string]bool
+	orgSuffixes   map[string]bool
+	placeHeads    map[string]bool
+	placeSuffixes map[string]bool
+	jobTitles     map[string]bool
+	connectors    map[string]bool
+	notNames      map[string]bool
+	notAcronyms   map[string]bool
+}{
+	regexp.MustCompile(`[\p{L}\p{N}]+(?:['’&-][\p{L}\p{N}]+)*`),
+	regexp.MustCompile(`['’]s$`),
+	wordSet("University Bank Ministry Department Office Church Council Court"),
+	wordSet(`Ltd Limited Inc Plc plc PLC LLP Corp Corporation Company Co Group Holdings Council Party University College
+		School Hospital Bank Police Court Committee Commission Foundation Trust Institute Institution Society Union
+		Association Agency Authority Board Service Services Office Department Ministry Club FC Airways Airlines
+		Federation League Network Partnership Campaign Coalition Alliance Centre Center Fund Museum Gallery Theatre Infirmary`),
+	wordSet("Lake Mount Mountains River Isle Gulf Bay Cape Greater"),
+	wordSet(`Street Road Avenue Lane Square Park River Lake Island Islands Mountains Mountain Hill Hills County City
+		Valley Bay Coast Sea Ocean Bridge Estate Heath Forest Province State District`),
+	wordSet(`President Prime Minister Chancellor Secretary Foreign Home Health Education Justice Defence Senator
+		Governor Mayor King Queen Prince Princess Duke Duchess Chief Executive Judge General Captain Inspector
+		Detective Sergeant Constable Officer Councillor Bishop Archbishop Pope Coach Manager Chairman Chairwoman
+		Chair Director Professor Former Deputy Vice Leader Labour Conservative Tory Democrat Republican MP`),
+	wordSet("of van von de der den du da di le la bin al"),
+	wordSet(`January February March April May June July August September October November December
+		Monday Tuesday Wednesday Thursday Friday Saturday Sunday Christmas Easter New Year Day Eve Street Road`),
+	wordSet("TV OK AM PM CEO GDP MP MPs BST GMT UTC DJ VIP ID PC FAQ AI"),
+}
+
+// wordSet makes a lookup set from a space-separated list of words
+func wordSet(words string) map[string]bool {
+	set := map[string]bool{}
+	for _, w := range strings.Fields(words) {
+		set[w] = true
+	}
+	return set
+}
+
+// entityToken is a word within a block of text
+type entityToken struct {
+	start, end int
+	txt        string
+}
+
+// entityTokens splits txt into words (dropping any "'s")
+func entityTokens(txt string) []entityToken {
+	toks := []entityToken{}
+	for _, m := range entityPats.wordPat.FindAllStringIndex(txt, -1) {
+		tok := entityToken{m[0], m[1], txt[m[0]:m[1]]}
+		if loc := entityPats.possessivePat.FindStringIndex(tok.txt); loc != nil {
+			tok.end -= len(tok.txt) - loc[0]
+			tok.txt = tok.txt[:loc[0]]
+		}
+		toks = append(toks, tok)
+	}
+	return toks
+}
+
+// tokenKey joins up tokens for gazetteer lookups
+func tokenKey(toks []entityToken) string {
+	words := make([]string, len(toks))
+	for i, tok := range toks {
+		words[i] = tok.txt
+	}
+	return strings.Join(words, " ")
+}
+
+func isCapitalised(word string) bool {
+	r, _ := utf8.DecodeRuneInString(word)
+	return unicode.IsUpper(r)
+}
+
+func isAcronym(word string) bool {
+	if len(word) < 2 || len(word) > 6 {
+		return false
+	}
+	for _, r := range word {
+		if !unicode.IsUpper(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// maxEntityWords is the longest run of words considered as a single entity
+const maxEntityWords = 6
+
+// entityCandidate is a possible mention found in the text. Kind is empty
+// for lone capitalised words, which only count if they turn out to be
+// the surname of someone mentioned in full.
+type entityCandidate struct {
+	kind    EntityKind
+	name    string
+	mention Mention
+}
+
+// grabEntities finds the people, organisations and places mentioned in
+// the (sanitised) content. The most-mentioned come first.
+func grabEntities(blocks []contentBlock, gaz *Gazetteer) []Entity {
+	dbug := Debug.EntitiesLogger
+	candidates := []entityCandidate{}
+	for pos, b := range blocks {
+		for _, c := range findEntityCandidates(b.Text, gaz) {
+			c.mention.Position = pos
+			candidates = append(candidates, c)
+		}
+	}
+
+	// collect mentions of each entity
+	type entityKey struct {
+		kind EntityKind
+		name string
+	}
+	entities := map[entityKey]*Entity{}
+	order := []*Entity{}
+	for _, c := range candidates {
+		if c.kind == "" {
+			continue
+		}
+		k := entityKey{c.kind, c.name}
+		e, got := entities[k]
+		if !got {
+			e = &Entity{Name: c.name, Kind: c.kind}
+			entities[k] = e
+			order = append(order, e)
+		}
+		e.Mentions = append(e.Mentions, c.mention)
+	}
+
+	// fold surnames ("Smith", "Mr Smith") into full names ("John Smith")
+	surnames := map[string]*Entity{}
+	for _, e := range order {
+		parts := strings.Fields(e.Name)
+		if e.Kind != EntityPerson || len(parts) < 2 {
+			continue
+		}
+		surname := parts[len(parts)-1]
+		if _, got := surnames[surname]; !got {
+			surnames[surname] = e
+		}
+	}
+	for _, c := range candidates {
+		if c.kind != "" {
+			continue
+		}
+		if e, got := surnames[c.name]; got {
+			e.Mentions = append(e.Mentions, c.mention)
+		}
+	}
+	merged := map[*Entity]bool{}
+	for _, e := range order {
+		if e.Kind == EntityPerson && !strings.Contains(e.Name, " ") {
+			if full, got := surnames[e.Name]; got {
+				full.Mentions = append(full.Mentions, e.Mentions...)
+				merged[e] = true
+			}
+		}
+	}
+	out := []Entity{}
+	for _, e := range order {
+		if !merged[e] {
+			out = append(out, *e)
+		}
+	}
+
+	for i := range out {
+		e := &out[i]
+		sort.SliceStable(e.Mentions, func(a, b int) bool {
+			if e.Mentions[a].Position != e.Mentions[b].Position {
+				return e.Mentions[a].Position < e.Mentions[b].Position
+			}
+			return e.Mentions[a].Offset < e.Mentions[b].Offset
+		})
+		e.Count = len(e.Mentions)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Count > out[j].Count })
+	for _, e := range out {
+		dbug.Printf("%s %q: %d\n", e.Kind, e.Name, e.Count)
+	}
+	return out
+}
+
+// findEntityCandidates looks for entity mentions in a block of text
+func findEntityCandidates(txt string, gaz *Gazetteer) []entityCandidate {
+	found := []entityCandidate{}
+	toks := entityTokens(txt)
+	for i := 0; i < len(toks); {
+		tok := toks[i]
+		if !isCapitalised(tok.txt) || quotePats.stopWords[strings.ToLower(tok.txt)] {
+			i++
+			continue
+		}
+
+		// grab a run of capitalised words (with the odd "of", "van" etc)
+		last := i
+		for j := i + 1; j < len(toks) && j-i < maxEntityWords; j++ {
+			gap := txt[toks[j-1].end:toks[j].start]
+			prev := toks[j-1].txt
+			if gap != " " && !(gap == ". " && (utf8.RuneCountInString(prev) == 1 || quotePats.titles[strings.ToLower(prev)])) {
+				break
+			}
+			if isCapitalised(toks[j].txt) {
+				last = j
+				continue
+			}
+			if !entityPats.connectors[toks[j].txt] {
+				break
+			}
+		}
+		run := toks[i : last+1]
+		words := make([]string, len(run))
+		for j, t := range run {
+			words[j] = t.txt
+		}
+
+		// the run as a whole looks like an organisation or place
+		// ("Leeds General Infirmary")? If not, check the gazetteer.
+		if kind := entityShape(words); kind != "" {
+			found = append(found, entityCandidate{kind, strings.Join(words, " "), Mention{Offset: tok.start, Text: txt[tok.start:run[len(run)-1].end]}})
+			i = last + 1
+			continue
+		}
+		if e, n := gaz.lookup(txt, toks[i:]); n > 0 {
+			end := toks[i+n-1].end
+			found = append(found, entityCandidate{e.kind, e.name, Mention{Offset: tok.start, Text: txt[tok.start:end]}})
+			i += n
+			continue
+		}
+
+		kind, name := classifyEntity(words)
+		if kind == "" && (len(run) > 1 || name == "") {
+			// no luck - try again from the next word
+			i++
+			continue
+		}
+		found = append(found, entityCandidate{kind, name, Mention{Offset: tok.start, Text: txt[tok.start:run[len(run)-1].end]}})
+		i = last + 1
+	}
+	return found
+}
+
+// entityShape spots organisations and places by the words they start
+// or end with ("University of...", "...Council", "...Street").
+// Returns an empty kind if it can't tell.
+func entityShape(words []string) EntityKind {
+	if len(words) < 2 {
+		return ""
+	}
+	first, last := words[0], words[len(words)-1]
+	for i, w := range words {
+		if w == "of" && i > 0 {
+			// "Royal College of Nursing", "Isle of Man"
+			last = words[i-1]
+			break
+		}
+	}
+	switch {
+	case entityPats.orgSuffixes[last] || entityPats.orgHeads[first]:
+		return EntityOrganisation
+	case entityPats.placeSuffixes[last] || entityPats.placeHeads[first]:
+		return EntityPlace
+	}
+	return ""
+}
+
+// classifyEntity works out what a run of capitalised words refers to,
+// once entityShape and the gazetteer have had a go.
+// Returns an empty kind if it can't tell (or for a lone word, which might
+// be a surname).
+func classifyEntity(words []string) (EntityKind, string) {
+	name := strings.Join(words, " ")
+	if len(words) == 1 && isAcronym(name) && !entityPats.notAcronyms[name] {
+		return EntityOrganisation, name
+	}
+
+	// lose any titles
+	titled := false
+	for len(words) > 0 && (entityPats.jobTitles[words[0]] || quotePats.titles[strings.ToLower(words[0])]) {
+		words = words[1:]
+		titled = true
+	}
+	if len(words) == 0 || entityPats.connectors[words[0]] {
+		return "", ""
+	}
+	for _, w := range words {
+		if entityPats.notNames[w] || w == "of" {
+			return "", ""
+		}
+	}
+	name = strings.Join(words, " ")
+	if titled {
+		return EntityPerson, name
+	}
+	if len(words) == 1 {
+		// maybe a surname
+		return "", name
+	}
+	if len(words) <= 4 && rateName(name) > 0 {
+		return EntityPerson, name
+	}
+	return "", ""
+}
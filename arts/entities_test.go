@@ -0,0 +1,93 @@
+package arts
+
+import (
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+	"strings"
+	"testing"
+)
+
+func TestGrabEntities(t *testing.T) {
+	root := parseDoc(`<html><body><div id="content">
+<p>Health Secretary Jane Smith visited Leeds General Infirmary on Tuesday.</p>
+<p>Smith told the BBC that the NHS was under pressure in England and Wales.</p>
+<p>The Royal College of Nursing said Ms Smith's plans for Leeds would not work.</p>
+<p>Bob Roberts, of Acme Widgets Ltd, said staff at the hospital on Park Road were exhausted.</p>
+</div></body></html>`)
+
+	content := []*html.Node{cascadia.MustCompile("#content").MatchFirst(root)}
+	got := grabEntities(splitBlocks(content), DefaultGazetteer)
+
+	expected := []struct {
+		name  string
+		kind  EntityKind
+		count int
+	}{
+		{"Jane Smith", EntityPerson, 3},
+		{"Leeds General Infirmary", EntityOrganisation, 1},
+		{"BBC", EntityOrganisation, 1},
+		{"NHS", EntityOrganisation, 1},
+		{"England", EntityPlace, 1},
+		{"Wales", EntityPlace, 1},
+		{"Royal College of Nursing", EntityOrganisation, 1},
+		{"Leeds", EntityPlace, 1},
+		{"Bob Roberts", EntityPerson, 1},
+		{"Acme Widgets Ltd", EntityOrganisation, 1},
+		{"Park Road", EntityPlace, 1},
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("got %d entities (expected %d)", len(got), len(expected))
+	}
+	for i, e := range got {
+		if e.Name != expected[i].name || e.Kind != expected[i].kind || e.Count != expected[i].count {
+			t.Errorf("got %s %q x%d (expected %s %q x%d)", e.Kind, e.Name, e.Count,
+				expected[i].kind, expected[i].name, expected[i].count)
+		}
+	}
+
+	// check the offsets
+	txt := splitBlocks(content)[2].Text
+	for _, m := range got[0].Mentions {
+		if m.Position != 2 {
+			continue
+		}
+		if !strings.HasPrefix(txt[m.Offset:], m.Text) || m.Text != "Ms Smith" {
+			t.Errorf("bad mention: %+v", m)
+		}
+	}
+}
+
+func TestGazetteer(t *testing.T) {
+	gaz := NewGazetteer()
+	err := gaz.Load(strings.NewReader(`
+# test
+[places]
+United Kingdom|UK|U.K.
+[organisations]
+Acme Widgets|Acme
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testData := []struct {
+		txt      string
+		expected string
+		n        int
+	}{
+		{"UK", "United Kingdom", 1},
+		{"U.K. plans", "United Kingdom", 2},
+		{"United Kingdom", "United Kingdom", 2},
+		{"Acme Widgets, Acme", "Acme Widgets", 2},
+		{"United Nations", "", 0},
+	}
+	for _, dat := range testData {
+		e, n := gaz.lookup(dat.txt, entityTokens(dat.txt))
+		if e.name != dat.expected || n != dat.n {
+			t.Errorf("lookup(%q) = %q,%d (expected %q,%d)", dat.txt, e.name, n, dat.expected, dat.n)
+		}
+	}
+
+	if err := NewGazetteer().Load(strings.NewReader("London\n")); err == nil {
+		t.Errorf("expected error for entry outside a section")
+	}
+}
@@ -0,0 +1,265 @@
+package arts
+
+// gazetteer.go - lists of known people, organisations and places, to help
+// out the entity extraction.
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// EntityKind is the type of an entity (person, organisation or place)
+type EntityKind string
+
+const (
+	EntityPerson       EntityKind = "person"
+	EntityOrganisation EntityKind = "organisation"
+	EntityPlace        EntityKind = "place"
+)
+
+// Gazetteer holds known entity names (and their aliases).
+//
+// Gazetteer files are plain text, one entity per line, with aliases
+// separated by "|" (the first name is the one reported). Lines are
+// grouped into [people], [organisations] and [places] sections, and
+// '#' starts a comment:
+//
+//	[places]
+//	United Kingdom|UK|Britain
+//	[organisations]
+//	BBC|British Broadcasting Corporation
+//
+// Names are case-sensitive (so "US" doesn't match "us").
+type Gazetteer struct {
+	names    map[string]gazetteerEntry
+	maxWords int
+}
+
+type gazetteerEntry struct {
+	kind EntityKind
+	name string
+}
+
+// NewGazetteer returns an empty Gazetteer
+func NewGazetteer() *Gazetteer {
+	return &Gazetteer{names: map[string]gazetteerEntry{}}
+}
+
+// Clone returns a copy of the gazetteer, to add more entries to
+func (g *Gazetteer) Clone() *Gazetteer {
+	out := NewGazetteer()
+	for k, v := range g.names {
+		out.names[k] = v
+	}
+	out.maxWords = g.maxWords
+	return out
+}
+
+// Add adds an entity, along with any aliases for it
+func (g *Gazetteer) Add(kind EntityKind, name string, aliases ...string) {
+	for _, alias := range append([]string{name}, aliases...) {
+		toks := entityTokens(alias)
+		if len(toks) == 0 {
+			continue
+		}
+		g.names[tokenKey(toks)] = gazetteerEntry{kind, name}
+		if len(toks) > g.maxWords {
+			g.maxWords = len(toks)
+		}
+	}
+}
+
+// Load reads entries from a gazetteer file (see Gazetteer for the format)
+func (g *Gazetteer) Load(r io.Reader) error {
+	var kind EntityKind
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			switch strings.ToLower(strings.Trim(line, "[] ")) {
+			case "people", "persons":
+				kind = EntityPerson
+			case "organisations", "organizations":
+				kind = EntityOrganisation
+			case "places":
+				kind = EntityPlace
+			default:
+				return fmt.Errorf("line %d: unknown section %s", lineNum, line)
+			}
+			continue
+		}
+		if kind == "" {
+			return fmt.Errorf("line %d: entry outside of a section", lineNum)
+		}
+		names := strings.Split(line, "|")
+		for i := range names {
+			names[i] = strings.TrimSpace(names[i])
+		}
+		g.Add(kind, names[0], names[1:]...)
+	}
+	return scanner.Err()
+}
+
+// lookup returns the longest entry matching the start of toks.
+// Returns the number of tokens matched (0 for no match).
+func (g *Gazetteer) lookup(txt string, toks []entityToken) (gazetteerEntry, int) {
+	// the words can be separated by spaces or dots (eg "U.S.")
+	n := 1
+	for n < g.maxWords && n < len(toks) && strings.Trim(txt[toks[n-1].end:toks[n].start], " .&") == "" {
+		n++
+	}
+	for ; n > 0; n-- {
+		if e, got := g.names[tokenKey(toks[:n])]; got {
+			return e, n
+		}
+	}
+	return gazetteerEntry{}, 0
+}
+
+// DefaultGazetteer is used by the entity extraction if
+// Options.Gazetteer isn't set. It just covers the obvious ones.
+var DefaultGazetteer = mustLoadGazetteer(defaultGazetteerSrc)
+
+func mustLoadGazetteer(src string) *Gazetteer {
+	g := NewGazetteer()
+	if err := g.Load(strings.NewReader(src)); err != nil {
+		panic(err)
+	}
+	return g
+}
+
+const defaultGazetteerSrc = `
+[places]
+United Kingdom|UK|U.K.|Britain|Great Britain
+England
+Scotland
+Wales
+Northern Ireland
+Ireland|Republic of Ireland
+United States|US|U.S.|USA|America|United States of America
+Canada
+Mexico
+Brazil
+Argentina
+France
+Germany
+Italy
+Spain
+Portugal
+Netherlands|Holland
+Belgium
+Switzerland
+Austria
+Sweden
+Norway
+Denmark
+Finland
+Poland
+Greece
+Turkey
+Russia
+Ukraine
+China
+Japan
+India
+Pakistan
+Afghanistan
+Iran
+Iraq
+Syria
+Israel
+Egypt
+Saudi Arabia
+South Africa
+Nigeria
+Kenya
+Australia
+New Zealand
+South Korea
+North Korea
+Europe
+Africa
+Asia
+Middle East
+London
+Edinburgh
+Glasgow
+Cardiff
+Belfast
+Dublin
+Manchester
+Birmingham
+Liverpool
+Leeds
+Bristol
+Newcastle
+Sheffield
+Oxford
+Cambridge
+Paris
+Berlin
+Madrid
+Rome
+Brussels
+Amsterdam
+Moscow
+Beijing
+Tokyo
+New Delhi|Delhi
+Washington|Washington DC
+New York|New York City
+Los Angeles
+Chicago
+San Francisco
+Sydney
+Melbourne
+Toronto
+Hong Kong
+Jerusalem
+
+[organisations]
+BBC|British Broadcasting Corporation
+NHS|National Health Service
+United Nations|UN|U.N.
+European Union|EU
+Nato|NATO
+World Health Organization|WHO|World Health Organisation
+International Monetary Fund|IMF
+World Bank
+Bank of England
+House of Commons
+House of Lords
+Home Office
+Foreign Office
+Treasury
+Downing Street
+White House
+Kremlin
+Pentagon
+Labour|Labour Party
+Conservative Party|Conservatives|Tories|Tory Party
+Liberal Democrats|Lib Dems
+Scottish National Party|SNP
+Democratic Party|Democrats
+Republican Party|Republicans
+Metropolitan Police|Met Police
+Reuters
+Associated Press
+Google
+Apple
+Microsoft
+Amazon
+Facebook
+Twitter
+`
@@ -0,0 +1,187 @@
+package arts
+
+// images.go - code to pick out the images in the article content, along
+// with their captions and photo credits
+// eg:
+//   <figure>
+//     <img src="/pics/may.jpg" alt="Theresa May">
+//     <figcaption>Theresa May in Downing Street. Photograph: Jane Doe/Getty Images</figcaption>
+//   </figure>
+
+import (
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var imagePats = struct {
+	imgSel              cascadia.Selector
+	figureSel           cascadia.Selector
+	captionClassPat     *regexp.Regexp
+	bareCreditClassPat  *regexp.Regexp
+	creditClassPat      *regexp.Regexp
+	containerClassPat   *regexp.Regexp
+	creditIndicative    *regexp.Regexp
+	copyrightIndicative *regexp.Regexp
+}{
+	cascadia.MustCompile(`img, amp-img`),
+	cascadia.MustCompile(`figure`),
+	regexp.MustCompile(`(?i)caption|photo-?credit|image-?credit|img-?credit|media-?credit|pic-?credit`),
+	// plain "credit" could just as well be a byline ("article-credit")
+	regexp.MustCompile(`(?i)\bcredit\b`),
+	regexp.MustCompile(`(?i)credit|copyright|source`),
+	regexp.MustCompile(`(?i)caption|image|figure|media|photo|picture`),
+	// "Photograph: Jane Doe/Getty Images" etc (en, de, fr, es, it, nl)
+	regexp.MustCompile(`(?i)(?:^|\s|[.(\[])(?:photographs?|photos?|pictures?|pics?|images?|illustrations?|credit|foto|fotos|bild|crédit|imagen)(?: by)?\s*[:：]\s*(.+?)\s*[)\]]?\s*$`),
+	regexp.MustCompile(`(?i)(?:©|\(c\)|copyright)\s*(.+?)\s*$`),
+}
+
+// isCaption returns true if n looks like a caption or photo credit
+func isCaption(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	if n.DataAtom == atom.Figcaption {
+		return true
+	}
+	if imagePats.captionClassPat.MatchString(getAttr(n, "class")) ||
+		imagePats.captionClassPat.MatchString(getAttr(n, "id")) {
+		return true
+	}
+	if imagePats.bareCreditClassPat.MatchString(getAttr(n, "class")) ||
+		imagePats.bareCreditClassPat.MatchString(getAttr(n, "id")) {
+		return inImageContainer(n)
+	}
+	return false
+}
+
+// inImageContainer returns true if n is within a figure, or within an
+// image container (eg <div class="photo"><img ...><span>...</span></div>)
+func inImageContainer(n *html.Node) bool {
+	if closest(n, imagePats.figureSel) != nil {
+		return true
+	}
+	for p := n.Parent; p != nil; p = p.Parent {
+		if !imagePats.containerClassPat.MatchString(getAttr(p, "class")) {
+			continue
+		}
+		for child := p.FirstChild; child != nil; child = child.NextSibling {
+			if imagePats.imgSel.Match(child) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// insideCaption returns true if n is (or is within) a caption or photo credit
+func insideCaption(n *html.Node) bool {
+	for ; n != nil; n = n.Parent {
+		if isCaption(n) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitCredit splits caption text into caption and photo credit, eg:
+// "Theresa May. Photograph: Jane Doe/Getty" => "Theresa May.", "Jane Doe/Getty"
+func splitCredit(txt string) (string, string) {
+	txt = compressSpace(txt)
+	for _, pat := range []*regexp.Regexp{imagePats.creditIndicative, imagePats.copyrightIndicative} {
+		m := pat.FindStringSubmatchIndex(txt)
+		if m != nil {
+			return strings.TrimSpace(txt[:m[0]]), txt[m[2]:m[3]]
+		}
+	}
+	return txt, ""
+}
+
+// parseCaption extracts the caption text and photo credit from a caption
+// node. The credit might be explicitly marked up, or just part of the text.
+func parseCaption(capNode *html.Node) (string, string) {
+	credit := ""
+	var walk func(n *html.Node) string
+	walk = func(n *html.Node) string {
+		if n.Type == html.TextNode {
+			return n.Data
+		}
+		if n.Type == html.ElementNode && imagePats.creditClassPat.MatchString(getAttr(n, "class")) {
+			credit = compressSpace(getTextContent(n))
+			return ""
+		}
+		txt := ""
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			txt += walk(child)
+		}
+		return txt
+	}
+	caption := compressSpace(walk(capNode))
+
+	if credit != "" {
+		// strip any "Photograph:" etc from marked-up credit
+		if _, c := splitCredit(credit); c != "" {
+			credit = c
+		}
+		return caption, credit
+	}
+	return splitCredit(caption)
+}
+
+// grabImages finds the images within the content, along with any captions.
+// Returns the images and the caption nodes found.
+func grabImages(contentNodes []*html.Node, baseURL *url.URL) ([]Image, []*html.Node) {
+	dbug := Debug.ContentLogger
+	images := []Image{}
+	captionNodes := []*html.Node{}
+
+	for _, contentNode := range contentNodes {
+		for _, img := range imagePats.imgSel.MatchAll(contentNode) {
+			src := getAttr(img, "src")
+			if src == "" {
+				continue
+			}
+			u, err := baseURL.Parse(src)
+			if err != nil {
+				continue
+			}
+			im := Image{URL: u.String(), Alt: compressSpace(getAttr(img, "alt"))}
+
+			// find the container holding the image and its caption
+			container := closest(img, imagePats.figureSel)
+			if container == nil && img.Parent != nil && imagePats.containerClassPat.MatchString(getAttr(img.Parent, "class")) {
+				container = img.Parent
+			}
+			if container != nil {
+				// outermost captions within the container
+				var captionSel cascadia.Selector = func(n *html.Node) bool {
+					if n == container || !isCaption(n) {
+						return false
+					}
+					for p := n.Parent; p != container; p = p.Parent {
+						if isCaption(p) {
+							return false
+						}
+					}
+					return true
+				}
+				for _, capNode := range captionSel.MatchAll(container) {
+					captionNodes = append(captionNodes, capNode)
+					caption, credit := parseCaption(capNode)
+					if caption != "" {
+						im.Caption = caption
+					}
+					if credit != "" {
+						im.Credit = credit
+					}
+				}
+			}
+			dbug.Printf("image %s (caption %q, credit %q)\n", im.URL, im.Caption, im.Credit)
+			images = append(images, im)
+		}
+	}
+	return images, captionNodes
+}
@@ -0,0 +1,87 @@
+package arts
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitCredit(t *testing.T) {
+	testData := []struct {
+		txt     string
+		caption string
+		credit  string
+	}{
+		{"Theresa May in Downing Street. Photograph: Jane Doe/Getty Images", "Theresa May in Downing Street.", "Jane Doe/Getty Images"},
+		{"A cat (Picture: Fred Bloggs)", "A cat", "Fred Bloggs"},
+		{"Angela Merkel. Foto: dpa", "Angela Merkel.", "dpa"},
+		{"A dog © Reuters", "A dog", "Reuters"},
+		{"No credit here", "No credit here", ""},
+	}
+	for _, dat := range testData {
+		caption, credit := splitCredit(dat.txt)
+		if caption != dat.caption || credit != dat.credit {
+			t.Errorf("splitCredit(%q) = %q, %q (expected %q, %q)", dat.txt, caption, credit, dat.caption, dat.credit)
+		}
+	}
+}
+
+func TestGrabImages(t *testing.T) {
+	src := `<html><head><title>Cats and dogs</title></head><body>
+<h1>Cats and dogs</h1>
+<p class="byline">By <a rel="author" href="/profile/fred-bloggs">Fred Bloggs</a></p>
+<div class="article">
+` + testPara("") + `
+<figure><img src="/pics/cat.jpg" alt="a cat"><figcaption>A cat, sitting on a mat. <span class="credit">Photograph: Jane Doe/Getty Images</span></figcaption></figure>
+` + testPara("") + `
+<div class="wp-caption"><img src="http://example.com/pics/dog.jpg"><p class="wp-caption-text">A lazy dog. Photo: John Smith</p></div>
+` + testPara("") + `
+</div></body></html>`
+
+	art, err := ExtractFromHTMLWithOptions([]byte(src), "http://example.com/news/cats-and-dogs", &Options{StripCaptions: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Image{
+		{URL: "http://example.com/pics/cat.jpg", Alt: "a cat", Caption: "A cat, sitting on a mat.", Credit: "Jane Doe/Getty Images"},
+		{URL: "http://example.com/pics/dog.jpg", Caption: "A lazy dog.", Credit: "John Smith"},
+	}
+	if len(art.Images) != len(expected) {
+		t.Fatalf("got %d images (expected %d)", len(art.Images), len(expected))
+	}
+	for i, im := range art.Images {
+		if im != expected[i] {
+			t.Errorf("got %+v (expected %+v)", im, expected[i])
+		}
+	}
+	if strings.Contains(art.Content, "Photo") {
+		t.Errorf("captions not stripped from content")
+	}
+	for _, a := range art.Authors {
+		if a.Name != "Fred Bloggs" {
+			t.Errorf("unexpected author %q", a.Name)
+		}
+	}
+}
+
+func TestCreditClass(t *testing.T) {
+	para := testPara("")
+	for _, class := range []string{"article-credit", "byline credit"} {
+		src := `<html><head><title>Cats and dogs</title></head><body>
+<h1>Cats and dogs</h1>
+<div class="` + class + `">By <a rel="author" href="/profile/fred-bloggs">Fred Bloggs</a></div>
+<div class="article">` + para + `
+<div class="photo"><img src="/pics/cat.jpg"><span class="credit">Jane Doe/Getty Images</span></div>` + para + para + `</div>
+</body></html>`
+
+		art, err := ExtractFromHTML([]byte(src), "http://example.com/news/cats-and-dogs")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(art.Authors) != 1 || art.Authors[0].Name != "Fred Bloggs" {
+			t.Errorf("%q: bad authors: %v", class, art.Authors)
+		}
+		if len(art.Images) != 1 || art.Images[0].Credit != "Jane Doe/Getty Images" {
+			t.Errorf("%q: bad images: %+v", class, art.Images)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package arts
+
+// landmarks.go - html5/aria landmarks (<main>, <nav>, role="complementary"
+// etc). Sites which use them are telling us straight out where the
+// article is, and which bits are navigation, sidebars and page furniture.
+
+import (
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"strings"
+)
+
+// landmark roles which never hold article text
+var excludedLandmarks = map[string]bool{
+	"navigation":    true,
+	"complementary": true,
+	"contentinfo":   true,
+	"banner":        true,
+	"search":        true,
+}
+
+// the ARIA landmark roles
+var landmarkRoles = map[string]bool{
+	"banner":        true,
+	"navigation":    true,
+	"main":          true,
+	"complementary": true,
+	"contentinfo":   true,
+	"search":        true,
+	"form":          true,
+}
+
+// landmarkRole returns the landmark role of a node (explicit or implicit),
+// or "" if it isn't a landmark.
+func landmarkRole(n *html.Node) string {
+	if n.Type != html.ElementNode {
+		return ""
+	}
+	if roles := strings.Fields(strings.ToLower(getAttr(n, "role"))); len(roles) > 0 {
+		// first landmark role is the one that counts, and any other role
+		// (eg "presentation") overrides the implicit one
+		for _, role := range roles {
+			if landmarkRoles[role] {
+				return role
+			}
+		}
+		return ""
+	}
+	switch n.DataAtom {
+	case atom.Main:
+		return "main"
+	case atom.Nav:
+		return "navigation"
+	case atom.Aside:
+		// only asides scoped to the body or <main> (not fact boxes and
+		// pull-quotes within an article or section, unless they're named)
+		if inSection(n, false) && getAttr(n, "aria-label") == "" && getAttr(n, "aria-labelledby") == "" {
+			return ""
+		}
+		return "complementary"
+	case atom.Header, atom.Footer:
+		// only page-level headers and footers count
+		if inSection(n, true) {
+			return ""
+		}
+		if n.DataAtom == atom.Header {
+			return "banner"
+		}
+		return "contentinfo"
+	}
+	return ""
+}
+
+// inSection returns true if n is within sectioning content (<article>,
+// <aside>, <nav> or <section>), or optionally <main>
+func inSection(n *html.Node, includeMain bool) bool {
+	for p := n.Parent; p != nil; p = p.Parent {
+		switch p.DataAtom {
+		case atom.Article, atom.Aside, atom.Nav, atom.Section:
+			return true
+		case atom.Main:
+			if includeMain {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// closestLandmark returns the role of the nearest landmark containing n
+// (or n itself), or "" if none.
+func closestLandmark(n *html.Node) string {
+	for ; n != nil; n = n.Parent {
+		if role := landmarkRole(n); role != "" {
+			return role
+		}
+	}
+	return ""
+}
+
+// inExcludedLandmark returns true if n is within navigation, a sidebar or
+// other page furniture
+func inExcludedLandmark(n *html.Node) bool {
+	return excludedLandmarks[closestLandmark(n)]
+}
+
+// landmarkWeight returns a bonus for nodes within the main content area
+func landmarkWeight(n *html.Node) float64 {
+	if closestLandmark(n) == "main" {
+		return 10
+	}
+	return 0
+}
+
+// zapLandmarks removes any navigation, sidebars etc from within the content
+// (eg breadcrumbs or a sidebar inside the <main>)
+func zapLandmarks(contentNodes []*html.Node) {
+	dbug := Debug.ContentLogger
+	doomed := make([]*html.Node, 0, 8)
+	for _, contentNode := range contentNodes {
+		walkChildren(contentNode, func(n *html.Node) {
+			if role := landmarkRole(n); excludedLandmarks[role] {
+				dbug.Printf("kill %s: %s landmark\n", describeNode(n), role)
+				doomed = append(doomed, n)
+			}
+		})
+	}
+	for _, n := range doomed {
+		if n.Parent != nil {
+			n.Parent.RemoveChild(n)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package arts
+
+import (
+	"github.com/andybalholm/cascadia"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLandmarkRole(t *testing.T) {
+	root := parseDoc(`<html><body>
+<header id="banner"></header>
+<nav id="nav"></nav>
+<main id="main">
+<article id="art"><header id="artheader"></header><aside id="pullquote"></aside><footer id="artfooter"></footer></article>
+<section><aside id="named" aria-label="Related"></aside></section>
+<aside id="mainaside"></aside>
+</main>
+<aside id="bodyaside"></aside>
+<div id="sidebar" role="complementary navigation"></div>
+<div id="fallback" role="doc-toc navigation"></div>
+<div id="button" role="button"></div>
+<nav id="presentation" role="presentation"></nav>
+<div id="plain"></div>
+<footer id="footer"></footer>
+</body></html>`)
+
+	testData := []struct {
+		id       string
+		expected string
+	}{
+		{"banner", "banner"},
+		{"nav", "navigation"},
+		{"main", "main"},
+		{"art", ""},
+		{"artheader", ""},
+		{"pullquote", ""},
+		{"named", "complementary"},
+		{"mainaside", "complementary"},
+		{"bodyaside", "complementary"},
+		{"artfooter", ""},
+		{"sidebar", "complementary"},
+		{"fallback", "navigation"},
+		{"button", ""},
+		{"presentation", ""},
+		{"plain", ""},
+		{"footer", "contentinfo"},
+	}
+	for _, dat := range testData {
+		n := cascadia.MustCompile("#" + dat.id).MatchFirst(root)
+		if got := landmarkRole(n); got != dat.expected {
+			t.Errorf("landmarkRole(#%s) = %q (expected %q)", dat.id, got, dat.expected)
+		}
+	}
+}
+
+func TestLandmarkContent(t *testing.T) {
+	// the sidebar looks more content-y than the article...
+	src := `<html><body>
+<div id="wrapper">
+<div class="boxout" role="complementary"><div>` + testPara("SIDEBAR,,,,,,") + testPara("SIDEBAR,,,,,,") + testPara("SIDEBAR,,,,,,") + testPara("SIDEBAR,,,,,,") + `</div></div>
+<main><div>` + testPara("ARTICLE.") + testPara("ARTICLE.") +
+		`<nav class="crumbs"><p>Home, News, Foxes, Dogs, Jumping, Laziness, Annoyance, Repetition, Again and again</p></nav>` +
+		testPara("ARTICLE.") + `</div></main>
+</div></body></html>`
+
+	art, err := ExtractFromHTML([]byte(src), "http://example.com/news/foxes-and-dogs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(art.Content, "ARTICLE") {
+		t.Errorf("article content not found")
+	}
+	if strings.Contains(art.Content, "SIDEBAR") {
+		t.Errorf("sidebar picked up as content")
+	}
+	if strings.Contains(art.Content, "Home, News") {
+		t.Errorf("nav left in content")
+	}
+
+	// check the old behaviour is still available
+	art, err = ExtractFromHTMLWithOptions([]byte(src), "http://example.com/news/foxes-and-dogs", &Options{NoLandmarks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(art.Content, "SIDEBAR") {
+		t.Errorf("NoLandmarks: expected sidebar to win")
+	}
+}
+
+// TestLandmarkCorpus compares the extraction with and without landmarks
+// over the pages in testdata/landmarks. Elements marked data-expect="content"
+// should end up in the article, and data-expect="junk" ones shouldn't.
+// Using landmarks should get everything right, and never do worse.
+func TestLandmarkCorpus(t *testing.T) {
+	files, err := filepath.Glob("testdata/landmarks/*.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no test pages")
+	}
+	contentSel := cascadia.MustCompile(`[data-expect="content"]`)
+	junkSel := cascadia.MustCompile(`[data-expect="junk"]`)
+	for _, filename := range files {
+		raw, err := ioutil.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		root := parseDoc(string(raw))
+		// check returns the number of marked elements handled correctly
+		check := func(opts *Options) (int, []string) {
+			art, err := ExtractFromHTMLWithOptions(raw, "http://example.com/news/1234/some-story", opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			txt := compressSpace(getTextContent(parseDoc(art.Content)))
+			good, bad := 0, []string{}
+			for _, n := range contentSel.MatchAll(root) {
+				if s := compressSpace(getTextContent(n)); strings.Contains(txt, s) {
+					good++
+				} else {
+					bad = append(bad, "missing "+snip(s, 30))
+				}
+			}
+			for _, n := range junkSel.MatchAll(root) {
+				if s := compressSpace(getTextContent(n)); !strings.Contains(txt, s) {
+					good++
+				} else {
+					bad = append(bad, "included "+snip(s, 30))
+				}
+			}
+			return good, bad
+		}
+		total := len(contentSel.MatchAll(root)) + len(junkSel.MatchAll(root))
+		before, _ := check(&Options{NoLandmarks: true})
+		after, bad := check(nil)
+		t.Logf("%s: %d/%d without landmarks, %d/%d with", filename, before, total, after, total)
+		for _, b := range bad {
+			t.Errorf("%s: %s", filename, b)
+		}
+		if after < before {
+			t.Errorf("%s: landmarks made things worse (%d vs %d)", filename, after, before)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package arts
+
+// links.go - making the urls in the content absolute, and listing the
+// links within it (for citation analysis and the like).
+
+import (
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/publicsuffix"
+	"net/url"
+	"strings"
+)
+
+var linkPats = struct {
+	baseSel    cascadia.Selector
+	aSel       cascadia.Selector
+	imgSel     cascadia.Selector
+	urlAttrs   []string
+	badSchemes map[string]bool
+}{
+	cascadia.MustCompile(`base[href]`),
+	cascadia.MustCompile(`a[href]`),
+	cascadia.MustCompile(`img`),
+	// attributes holding a single url
+	[]string{"href", "src", "poster", "cite"},
+	// schemes which have no business in extracted content
+	map[string]bool{"javascript": true, "data": true, "vbscript": true},
+}
+
+// contentBaseURL works out what to resolve the urls in the content against.
+// That's the source url if it's absolute, or the canonical url if not (eg
+// for articles loaded from files), adjusted by any <base href>.
+func contentBaseURL(root *html.Node, srcURL *url.URL, canonicalURL string) *url.URL {
+	base := srcURL
+	if !srcURL.IsAbs() && canonicalURL != "" {
+		if u, err := url.Parse(canonicalURL); err == nil {
+			base = u
+		}
+	}
+	if b := linkPats.baseSel.MatchFirst(root); b != nil {
+		if u, err := base.Parse(strings.TrimSpace(getAttr(b, "href"))); err == nil {
+			base = u
+		}
+	}
+	return base
+}
+
+// resolveURL makes a url (from an attribute) absolute.
+// Returns false if the url should be dropped (javascript: etc).
+func resolveURL(raw string, baseURL *url.URL) (string, bool) {
+	raw = strings.TrimSpace(raw)
+	if i := strings.Index(raw, ":"); i > 0 {
+		scheme := strings.ToLower(strings.Join(strings.Fields(raw[:i]), ""))
+		if linkPats.badSchemes[scheme] {
+			return "", false
+		}
+	}
+	u, err := baseURL.Parse(raw)
+	if err != nil {
+		return "", false
+	}
+	return u.String(), true
+}
+
+// srcsetCandidate is a single image in a srcset attribute
+type srcsetCandidate struct {
+	url         string
+	descriptors string // eg "2x", "300w"
+}
+
+// parseSrcset splits a srcset attribute into its candidates, as per the
+// html spec. URLs can contain commas (eg "/w_300,c_fill/foo.jpg"), so a
+// url runs up to the next whitespace, and it's only the comma after the
+// descriptors which ends the candidate.
+func parseSrcset(srcset string) []srcsetCandidate {
+	isSpace := func(c byte) bool {
+		return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+	}
+	out := []srcsetCandidate{}
+	pos := 0
+	for {
+		for pos < len(srcset) && (isSpace(srcset[pos]) || srcset[pos] == ',') {
+			pos++
+		}
+		if pos >= len(srcset) {
+			return out
+		}
+		start := pos
+		for pos < len(srcset) && !isSpace(srcset[pos]) {
+			pos++
+		}
+		c := srcsetCandidate{url: srcset[start:pos]}
+		if strings.HasSuffix(c.url, ",") {
+			// no descriptors
+			c.url = strings.TrimRight(c.url, ",")
+		} else {
+			// descriptors run to the next comma (outside of any parens)
+			start = pos
+			depth := 0
+			for ; pos < len(srcset); pos++ {
+				ch := srcset[pos]
+				if ch == '(' {
+					depth++
+				} else if ch == ')' && depth > 0 {
+					depth--
+				} else if ch == ',' && depth == 0 {
+					break
+				}
+			}
+			c.descriptors = strings.Join(strings.Fields(srcset[start:pos]), " ")
+		}
+		if c.url != "" {
+			out = append(out, c)
+		}
+	}
+}
+
+// resolveSrcset makes all the urls in a srcset attribute absolute
+func resolveSrcset(srcset string, baseURL *url.URL) string {
+	out := []string{}
+	for _, c := range parseSrcset(srcset) {
+		u, ok := resolveURL(c.url, baseURL)
+		if !ok {
+			continue
+		}
+		if c.descriptors != "" {
+			u += " " + c.descriptors
+		}
+		out = append(out, u)
+	}
+	return strings.Join(out, ", ")
+}
+
+// absoluteURLs makes all the urls in the content absolute, and removes any
+// javascript: or data: ones. Images left without a src are removed.
+func absoluteURLs(node *html.Node, baseURL *url.URL) {
+	dbug := Debug.ContentLogger
+	doomed := []*html.Node{}
+	fn := func(n *html.Node) {
+		if n.Type != html.ElementNode {
+			return
+		}
+		filterAttrs(n, func(attr *html.Attribute) bool {
+			if attr.Key == "srcset" {
+				attr.Val = resolveSrcset(attr.Val, baseURL)
+				return attr.Val != ""
+			}
+			for _, k := range linkPats.urlAttrs {
+				if attr.Key == k {
+					u, ok := resolveURL(attr.Val, baseURL)
+					if !ok {
+						dbug.Printf("drop %s=%q from %s\n", attr.Key, snip(attr.Val, 40), describeNode(n))
+						return false
+					}
+					attr.Val = u
+				}
+			}
+			return true
+		})
+		if n.DataAtom == atom.Img && getAttr(n, "src") == "" {
+			doomed = append(doomed, n)
+		}
+	}
+	fn(node)
+	walkChildren(node, fn)
+	zapNodes(doomed)
+}
+
+// isExternalLink returns true if u is on a different site to the article
+// (subdomains count as the same site)
+func isExternalLink(u *url.URL, artURL *url.URL) bool {
+	host := strings.ToLower(u.Hostname())
+	artHost := strings.ToLower(artURL.Hostname())
+	if host == artHost {
+		return false
+	}
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return true
+	}
+	artDomain, err := publicsuffix.EffectiveTLDPlusOne(artHost)
+	if err != nil {
+		return true
+	}
+	return domain != artDomain
+}
+
+// grabLinks lists the http(s) links in the (sanitised) content, in order.
+// Position is the index of the block holding the link (or the block
+// within it, for links wrapped around images and the like).
+func grabLinks(contentNodes []*html.Node, blocks []contentBlock, artURL *url.URL) []Link {
+	blockAt := map[*html.Node]int{}
+	for i, b := range blocks {
+		for _, n := range b.nodes {
+			blockAt[n] = i
+		}
+	}
+
+	links := []Link{}
+	block := 0 // the latest block seen
+	for _, contentNode := range contentNodes {
+		fn := func(n *html.Node) {
+			if i, got := blockAt[n]; got {
+				block = i
+			}
+			if !linkPats.aSel.Match(n) {
+				return
+			}
+			u, err := url.Parse(getAttr(n, "href"))
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				return
+			}
+			l := Link{URL: u.String(), Text: compressSpace(getTextContent(n))}
+			if l.Text == "" {
+				if img := linkPats.imgSel.MatchFirst(n); img != nil {
+					l.Text = compressSpace(getAttr(img, "alt"))
+				}
+			}
+			l.External = isExternalLink(u, artURL)
+			l.Position = linkBlock(n, blockAt, block)
+			links = append(links, l)
+		}
+		fn(contentNode)
+		walkChildren(contentNode, fn)
+	}
+	return links
+}
+
+// linkBlock returns the index of the block holding a link, or the first
+// block within it. If neither, it falls back to latest (the last block
+// before the link).
+func linkBlock(a *html.Node, blockAt map[*html.Node]int, latest int) int {
+	for n := a; n != nil; n = n.Parent {
+		if i, got := blockAt[n]; got {
+			return i
+		}
+	}
+	found := -1
+	walkChildren(a, func(n *html.Node) {
+		if i, got := blockAt[n]; got && found < 0 {
+			found = i
+		}
+	})
+	if found >= 0 {
+		return found
+	}
+	return latest
+}
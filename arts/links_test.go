@@ -0,0 +1,97 @@
+package arts
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestContentLinks(t *testing.T) {
+	para := testPara("")
+	src := `<html><head><title>Foxes and dogs</title></head><body>
+<h1>Foxes and dogs</h1>
+<div class="article">` + para + `
+<p>According to <a href="/news/123-fox-report">an earlier report</a>, foxes have been at it for years, says <a href="https://www.example.org/foxes?id=1">the fox society</a>.</p>
+` + para + `
+<p>Some <a href="javascript:alert('hi')">dodgy links</a>, a <a href="http://blog.example.com/foxes">sister site</a>, and a picture: <img src="pics/fox.jpg" alt="a fox"> <img src="data:image/png;base64,AAAA" alt="tracker"></p>
+` + para + `</div>
+</body></html>`
+
+	art, err := ExtractFromHTML([]byte(src), "http://www.example.com/news/foxes-and-dogs")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, bad := range []string{`href="/news`, `src="pics`, "javascript:", "data:"} {
+		if strings.Contains(art.Content, bad) {
+			t.Errorf("content contains %q", bad)
+		}
+	}
+	for _, good := range []string{`href="http://www.example.com/news/123-fox-report"`, `src="http://www.example.com/news/pics/fox.jpg"`, ">dodgy links</a>"} {
+		if !strings.Contains(art.Content, good) {
+			t.Errorf("content missing %q", good)
+		}
+	}
+
+	expected := []Link{
+		{URL: "http://www.example.com/news/123-fox-report", Text: "an earlier report", External: false, Position: 1},
+		{URL: "https://www.example.org/foxes?id=1", Text: "the fox society", External: true, Position: 1},
+		{URL: "http://blog.example.com/foxes", Text: "sister site", External: false, Position: 3},
+	}
+	if len(art.Links) != len(expected) {
+		t.Fatalf("got %d links (expected %d): %+v", len(art.Links), len(expected), art.Links)
+	}
+	for i, l := range art.Links {
+		if l != expected[i] {
+			t.Errorf("got %+v (expected %+v)", l, expected[i])
+		}
+	}
+}
+
+func TestContentBaseURL(t *testing.T) {
+	testData := []struct {
+		src       string
+		srcURL    string
+		canonical string
+		expected  string
+	}{
+		{`<html><body></body></html>`, "http://example.com/news/foo", "", "http://example.com/news/foo"},
+		{`<html><body></body></html>`, "foo.html", "http://example.com/news/foo", "http://example.com/news/foo"},
+		{`<html><head><base href="/static/"></head><body></body></html>`, "http://example.com/news/foo", "", "http://example.com/static/"},
+	}
+	for _, dat := range testData {
+		root := parseDoc(dat.src)
+		u, _ := url.Parse(dat.srcURL)
+		got := contentBaseURL(root, u, dat.canonical).String()
+		if got != dat.expected {
+			t.Errorf("contentBaseURL(%q, %q) = %q (expected %q)", dat.srcURL, dat.canonical, got, dat.expected)
+		}
+	}
+}
+
+func TestResolveSrcset(t *testing.T) {
+	testData := []struct {
+		srcset   string
+		expected string
+	}{
+		{"/pics/fox.jpg", "http://example.com/pics/fox.jpg"},
+		{"/pics/fox.jpg 1x, /pics/fox-2x.jpg 2x", "http://example.com/pics/fox.jpg 1x, http://example.com/pics/fox-2x.jpg 2x"},
+		{" /pics/fox.jpg  300w ,/pics/fox-big.jpg 600w", "http://example.com/pics/fox.jpg 300w, http://example.com/pics/fox-big.jpg 600w"},
+		// commas inside urls (eg image CDN transforms)
+		{"/img/w_300,c_fill/fox.jpg 300w, /img/w_600,c_fill/fox.jpg 600w",
+			"http://example.com/img/w_300,c_fill/fox.jpg 300w, http://example.com/img/w_600,c_fill/fox.jpg 600w"},
+		// no descriptors, so a trailing comma ends the url
+		{"/pics/fox.jpg, /pics/fox-2x.jpg 2x", "http://example.com/pics/fox.jpg, http://example.com/pics/fox-2x.jpg 2x"},
+		{"/pics/fox.jpg 1x,/pics/fox-2x.jpg 2x", "http://example.com/pics/fox.jpg 1x, http://example.com/pics/fox-2x.jpg 2x"},
+		// bad urls dropped
+		{"data:image/png;base64,AAAA 1x, /pics/fox-2x.jpg 2x", "http://example.com/pics/fox-2x.jpg 2x"},
+		{"", ""},
+	}
+	base, _ := url.Parse("http://example.com/news/foo")
+	for _, dat := range testData {
+		got := resolveSrcset(dat.srcset, base)
+		if got != dat.expected {
+			t.Errorf("resolveSrcset(%q) = %q (expected %q)", dat.srcset, got, dat.expected)
+		}
+	}
+}
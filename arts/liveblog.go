@@ -0,0 +1,339 @@
+package arts
+
+// liveblog.go - code to split live blogs into their individual timestamped
+// entries.
+//
+// There are two sources of information:
+// - JSON-LD LiveBlogPosting metadata (reliable, when it's there)
+// - a repeating set of blocks within the page, each with its own timestamp
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/andybalholm/cascadia"
+	"github.com/bcampbell/arts/arts/byline"
+	"github.com/bcampbell/fuzzytime"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"regexp"
+	"strings"
+)
+
+var liveBlogPats = struct {
+	jsonLDSel        cascadia.Selector
+	containerSel     cascadia.Selector
+	likelyClassPat   *regexp.Regexp
+	timeSel          cascadia.Selector
+	headingSel       cascadia.Selector
+	paraSplitPat     *regexp.Regexp
+	minEntries       int
+	minUnmarkedCount int
+}{
+	cascadia.MustCompile(`script[type="application/ld+json"]`),
+	cascadia.MustCompile(`div,section,article,main,ol,ul`),
+	regexp.MustCompile(`(?i)live|blog-?post|timeline|update|entry|lb-`),
+	cascadia.MustCompile(`time`),
+	cascadia.MustCompile(`h1,h2,h3,h4,h5,h6`),
+	regexp.MustCompile(`\n\s*\n`),
+	// need at least this many timestamped blocks to call it a liveblog
+	3,
+	// ...or this many, if there is no indicative class/id
+	5,
+}
+
+// liveEntry is a LiveEntry plus the parsed timestamp, for ordering.
+type liveEntry struct {
+	LiveEntry
+	dt fuzzytime.DateTime
+}
+
+// grabLiveEntries looks for liveblog entries.
+// pageDate is used to fill in any entries with time-only timestamps.
+// Returns the entries (in document order) along with the timestamps of the
+// first and latest ones.
+func grabLiveEntries(root *html.Node, scriptNodes []*html.Node, cruftBlocks []*html.Node, pageDate fuzzytime.DateTime, policy *SanitisePolicy) ([]LiveEntry, fuzzytime.DateTime, fuzzytime.DateTime) {
+	dbug := Debug.LiveBlogLogger
+
+	entries := liveEntriesFromJSONLD(scriptNodes)
+	if len(entries) > 0 {
+		dbug.Printf("%d entries from JSON-LD\n", len(entries))
+	} else {
+		entries = liveEntriesFromHTML(root, cruftBlocks, pageDate, policy)
+		dbug.Printf("%d entries from html\n", len(entries))
+	}
+
+	var first, latest fuzzytime.DateTime
+	out := make([]LiveEntry, 0, len(entries))
+	for _, e := range entries {
+		// NOTE: comparing ISO strings. Fine as long as all the timestamps on
+		// the page are in the same form, which they almost always are.
+		iso := e.dt.ISOFormat()
+		if first.Empty() || iso < first.ISOFormat() {
+			first = e.dt
+		}
+		if latest.Empty() || iso > latest.ISOFormat() {
+			latest = e.dt
+		}
+		dbug.Printf("  %s %q (%d bytes)\n", iso, e.Headline, len(e.Content))
+		out = append(out, e.LiveEntry)
+	}
+	return out, first, latest
+}
+
+// liveEntriesFromJSONLD pulls out the liveBlogUpdate entries from any
+// LiveBlogPosting objects in json-ld scripts.
+func liveEntriesFromJSONLD(scriptNodes []*html.Node) []liveEntry {
+	dbug := Debug.LiveBlogLogger
+	out := []liveEntry{}
+	for _, script := range scriptNodes {
+		if !liveBlogPats.jsonLDSel.Match(script) {
+			continue
+		}
+		var data interface{}
+		err := json.Unmarshal([]byte(getTextContent(script)), &data)
+		if err != nil {
+			dbug.Printf("bad json-ld: %s\n", err)
+			continue
+		}
+		for _, posting := range findJSONLDObjects(data, "LiveBlogPosting") {
+			for _, upd := range jsonList(posting["liveBlogUpdate"]) {
+				obj, ok := upd.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				dt, _, _ := fuzzytime.Extract(jsonString(obj["datePublished"]))
+				if dt.Date.Empty() {
+					continue
+				}
+				e := liveEntry{dt: dt}
+				e.Published = dt.ISOFormat()
+				e.Headline = compressSpace(jsonString(obj["headline"]))
+				e.Authors = jsonLDAuthors(obj["author"])
+				e.Content = textToHTML(jsonString(obj["articleBody"]))
+				out = append(out, e)
+			}
+		}
+	}
+	return out
+}
+
+// findJSONLDObjects returns all the objects of the given @type within some
+// parsed json-ld (recursing into arrays, @graph etc).
+func findJSONLDObjects(data interface{}, typ string) []map[string]interface{} {
+	out := []map[string]interface{}{}
+	switch v := data.(type) {
+	case []interface{}:
+		for _, item := range v {
+			out = append(out, findJSONLDObjects(item, typ)...)
+		}
+	case map[string]interface{}:
+		for _, t := range jsonList(v["@type"]) {
+			if jsonString(t) == typ {
+				out = append(out, v)
+				return out
+			}
+		}
+		for _, child := range v {
+			out = append(out, findJSONLDObjects(child, typ)...)
+		}
+	}
+	return out
+}
+
+// jsonList treats a json value as a list (json-ld allows single values
+// in place of single-item arrays)
+func jsonList(v interface{}) []interface{} {
+	switch l := v.(type) {
+	case nil:
+		return []interface{}{}
+	case []interface{}:
+		return l
+	}
+	return []interface{}{v}
+}
+
+// jsonString returns a json value as a string, or "" if it isn't one.
+func jsonString(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+// jsonLDAuthors reads a json-ld author value, which could be a string, a
+// Person object, or a list of either.
+func jsonLDAuthors(v interface{}) []Author {
+	out := []Author{}
+	for _, item := range jsonList(v) {
+		name := jsonString(item)
+		if obj, ok := item.(map[string]interface{}); ok {
+			name = jsonString(obj["name"])
+		}
+		name = compressSpace(name)
+		if name != "" {
+			out = append(out, Author{Name: name})
+		}
+	}
+	return out
+}
+
+// textToHTML turns plain text into html paragraphs (split on blank lines)
+func textToHTML(txt string) string {
+	var out bytes.Buffer
+	for _, para := range liveBlogPats.paraSplitPat.Split(txt, -1) {
+		para = compressSpace(para)
+		if para == "" {
+			continue
+		}
+		out.WriteString("<p>" + html.EscapeString(para) + "</p>\n")
+	}
+	return out.String()
+}
+
+// liveEntriesFromHTML looks for a container holding a run of similar blocks,
+// each with its own timestamp.
+func liveEntriesFromHTML(root *html.Node, cruftBlocks []*html.Node, pageDate fuzzytime.DateTime, policy *SanitisePolicy) []liveEntry {
+	dbug := Debug.LiveBlogLogger
+
+	var best []*html.Node
+	bestScore := 0.0
+	for _, container := range liveBlogPats.containerSel.MatchAll(root) {
+		cls := getAttr(container, "class") + " " + getAttr(container, "id")
+		if bylineContainerPats.commentPat.MatchString(cls) {
+			continue
+		}
+		inCruft := false
+		for _, blk := range cruftBlocks {
+			if blk == container || contains(blk, container) {
+				inCruft = true
+				break
+			}
+		}
+		if inCruft {
+			continue
+		}
+
+		// group the children by tag and class, keeping only timestamped ones
+		groups := map[string][]*html.Node{}
+		for child := container.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type != html.ElementNode {
+				continue
+			}
+			if liveBlogPats.timeSel.MatchFirst(child) == nil {
+				continue
+			}
+			key := child.DataAtom.String() + "." + getAttr(child, "class")
+			groups[key] = append(groups[key], child)
+		}
+
+		for key, blocks := range groups {
+			if len(blocks) < liveBlogPats.minEntries {
+				continue
+			}
+			indicative := liveBlogPats.likelyClassPat.MatchString(cls) ||
+				liveBlogPats.likelyClassPat.MatchString(key)
+			if !indicative {
+				// could be any old list of links with dates. Insist on
+				// more entries and some decent amount of text in each.
+				textLen := 0
+				for _, blk := range blocks {
+					textLen += len(compressSpace(getTextContent(blk)))
+				}
+				if len(blocks) < liveBlogPats.minUnmarkedCount || textLen/len(blocks) < 80 {
+					continue
+				}
+			}
+
+			score := float64(len(blocks))
+			if indicative {
+				score += 3
+			}
+			dbug.Printf("candidate %s: %d %s blocks (score %.3g)\n", describeNode(container), len(blocks), key, score)
+			if score > bestScore {
+				best = blocks
+				bestScore = score
+			}
+		}
+	}
+
+	out := []liveEntry{}
+	for i, blk := range best {
+		if liveBlogPats.headingSel.Match(blk) {
+			// the entries are headings, with the content following on
+			var next *html.Node
+			if i+1 < len(best) {
+				next = best[i+1]
+			}
+			blk = headingEntry(blk, next)
+		}
+		e, ok := parseLiveEntry(blk, pageDate, policy)
+		if ok {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// headingEntry gathers up an entry which is just a heading, plus the
+// siblings following it (up to the next entry), into a new div.
+func headingEntry(heading *html.Node, next *html.Node) *html.Node {
+	wrapper := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}
+	for n := heading; n != nil && n != next; n = n.NextSibling {
+		wrapper.AppendChild(cloneNode(n))
+	}
+	return wrapper
+}
+
+// parseLiveEntry picks apart a single liveblog entry. The original node is
+// left untouched.
+func parseLiveEntry(blk *html.Node, pageDate fuzzytime.DateTime, policy *SanitisePolicy) (liveEntry, bool) {
+	e := liveEntry{}
+	blk = cloneNode(blk)
+
+	// timestamp
+	timeNode := matchFirstDescendant(blk, liveBlogPats.timeSel)
+	if timeNode == nil {
+		return e, false
+	}
+	txt := getAttr(timeNode, "datetime")
+	if txt == "" {
+		txt = getTextContent(timeNode)
+	}
+	dt, _, _ := fuzzytime.WesternContext.Extract(txt)
+	if dt.Date.Empty() {
+		// time-only is common - assume it's on the day of publication
+		dt.Date = pageDate.Date
+	}
+	if dt.Date.Empty() {
+		return e, false
+	}
+	e.dt = dt
+	e.Published = dt.ISOFormat()
+	zapNodes([]*html.Node{timeNode})
+
+	// headline
+	if h := matchFirstDescendant(blk, liveBlogPats.headingSel); h != nil {
+		e.Headline = compressSpace(getTextContent(h))
+		zapNodes([]*html.Node{h})
+	}
+
+	// author(s)
+	var authorSel cascadia.Selector = func(n *html.Node) bool {
+		return n.Type == html.ElementNode &&
+			(authorPats.likelyClassPat.MatchString(getAttr(n, "class")) ||
+				authorPats.likelyClassPat.MatchString(getAttr(n, "id")))
+	}
+	if a := matchFirstDescendant(blk, authorSel); a != nil {
+		for _, parsed := range byline.Parse(compressSpace(getTextContent(a))) {
+			e.Authors = append(e.Authors, Author{Name: parsed.Name, Email: parsed.Email})
+		}
+		zapNodes([]*html.Node{a})
+	}
+
+	// whatever's left is content
+	tidyNode(blk, policy)
+	var out bytes.Buffer
+	for child := blk.FirstChild; child != nil; child = child.NextSibling {
+		html.Render(&out, child)
+	}
+	e.Content = strings.TrimSpace(out.String())
+	return e, true
+}
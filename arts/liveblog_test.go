@@ -0,0 +1,104 @@
+package arts
+
+import (
+	"testing"
+)
+
+func TestLiveBlogJSONLD(t *testing.T) {
+	src := `<html><head>
+<title>Election live</title>
+<script type="application/ld+json">
+{"@context":"http://schema.org","@type":"LiveBlogPosting","headline":"Election live",
+ "liveBlogUpdate":[
+  {"@type":"BlogPosting","headline":"Polls close","datePublished":"2017-06-08T22:00:00Z",
+   "author":{"@type":"Person","name":"Fred Bloggs"},"articleBody":"The polls have closed."},
+  {"@type":"BlogPosting","headline":"First result","datePublished":"2017-06-08T23:05:00Z",
+   "author":[{"@type":"Person","name":"Jane Doe"}],"articleBody":"Newcastle declares.\n\nTurnout up."}
+ ]}
+</script>
+</head><body><h1>Election live</h1></body></html>`
+
+	art, err := ExtractFromHTML([]byte(src), "http://example.com/news/election-live")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(art.LiveEntries) != 2 {
+		t.Fatalf("got %d live entries (expected 2)", len(art.LiveEntries))
+	}
+	first, second := art.LiveEntries[0], art.LiveEntries[1]
+	if first.Headline != "Polls close" || second.Headline != "First result" {
+		t.Errorf("bad headlines: %q, %q", first.Headline, second.Headline)
+	}
+	if len(second.Authors) != 1 || second.Authors[0].Name != "Jane Doe" {
+		t.Errorf("bad authors: %v", second.Authors)
+	}
+	if second.Content != "<p>Newcastle declares.</p>\n<p>Turnout up.</p>\n" {
+		t.Errorf("bad content: %q", second.Content)
+	}
+	if art.Published != first.Published || art.Updated != second.Published {
+		t.Errorf("bad dates: published %q updated %q", art.Published, art.Updated)
+	}
+}
+
+func TestLiveBlogHTML(t *testing.T) {
+	src := `<html><head><title>Budget live</title></head><body>
+<h1>Budget live</h1>
+<div class="live-blog">
+ <div class="block"><time datetime="2017-03-08T13:30:00Z">13:30</time><h2>Speech ends</h2><p>The chancellor sits down.</p></div>
+ <div class="block"><time datetime="2017-03-08T12:45:00Z">12:45</time><p class="byline">By Fred Bloggs</p><p>National insurance goes up for the self-employed.</p></div>
+ <div class="block"><time datetime="2017-03-08T12:30:00Z">12:30</time><h2>Speech begins</h2><p>Here we go.</p></div>
+</div>
+<ul class="related"><li><time datetime="2017-01-01">1 Jan</time><a href="/a">a</a></li></ul>
+</body></html>`
+
+	art, err := ExtractFromHTML([]byte(src), "http://example.com/news/budget-live")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(art.LiveEntries) != 3 {
+		t.Fatalf("got %d live entries (expected 3)", len(art.LiveEntries))
+	}
+	if art.LiveEntries[0].Headline != "Speech ends" {
+		t.Errorf("bad headline: %q", art.LiveEntries[0].Headline)
+	}
+	if a := art.LiveEntries[1].Authors; len(a) != 1 || a[0].Name != "Fred Bloggs" {
+		t.Errorf("bad authors: %v", a)
+	}
+	if art.Published != art.LiveEntries[2].Published || art.Updated != art.LiveEntries[0].Published {
+		t.Errorf("bad dates: published %q updated %q", art.Published, art.Updated)
+	}
+}
+
+// entries which are just a heading, with the content following on
+func TestLiveBlogHeadingEntries(t *testing.T) {
+	src := `<html><head><title>Budget live</title></head><body>
+<h1>Budget live</h1>
+<div class="live-updates">
+ <h3><time datetime="2017-03-08T13:30:00Z">13:30</time> Speech ends</h3>
+ <p>The chancellor sits down.</p>
+ <h3><time datetime="2017-03-08T12:45:00Z">12:45</time> National insurance</h3>
+ <p>It goes up for the self-employed.</p>
+ <p>That's going to be unpopular.</p>
+ <h3><time datetime="2017-03-08T12:30:00Z">12:30</time> Speech begins</h3>
+ <p>Here we go.</p>
+</div>
+</body></html>`
+
+	art, err := ExtractFromHTML([]byte(src), "http://example.com/news/budget-live")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []LiveEntry{
+		{Published: "2017-03-08T13:30:00Z", Headline: "Speech ends", Content: "<p>The chancellor sits down.</p>"},
+		{Published: "2017-03-08T12:45:00Z", Headline: "National insurance", Content: "<p>It goes up for the self-employed.</p><p>That&#39;s going to be unpopular.</p>"},
+		{Published: "2017-03-08T12:30:00Z", Headline: "Speech begins", Content: "<p>Here we go.</p>"},
+	}
+	if len(art.LiveEntries) != len(expected) {
+		t.Fatalf("got %d live entries (expected %d)", len(art.LiveEntries), len(expected))
+	}
+	for i, e := range art.LiveEntries {
+		if e.Published != expected[i].Published || e.Headline != expected[i].Headline || e.Content != expected[i].Content {
+			t.Errorf("got %+v (expected %+v)", e, expected[i])
+		}
+	}
+}
@@ -0,0 +1,352 @@
+package arts
+
+// quotes.go - pulling direct quotations out of the content, and working
+// out who said them.
+//
+// Quotes are found within paragraphs (straight or curly quote marks,
+// possibly running on over several paragraphs) and blockquotes, and attributed using the text around them:
+//   "...," said John Smith.
+//   "...," John Smith, the chief executive, said.
+//   John Smith told the BBC: "..."
+//   "...", according to John Smith.
+// Pronouns ("he said") and bare surnames ("Smith said") are taken to refer
+// to an earlier speaker.
+
+import (
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// a capitalised word, initial or title within a name
+const quoteNameWord = `(?:(?:Mr|Mrs|Ms|Dr|Prof|Rev)\.|[\p{Lu}]\.|[\p{Lu}][\p{L}'’-]+)`
+const quoteNamePat = quoteNameWord + `(?:\s+(?:(?:van|von|de|der|den|du|da|di|le|la)\s+)?` + quoteNameWord + `){0,4}`
+
+// verbs which can come before the speaker ("said X")...
+const quoteVerbsFirst = `(?:said|says|added|adds|explained|insisted|warned|claimed|argued|stated|admitted|declared|continued|replied|wrote|tweeted|recalled|noted)`
+
+// ...and after it ("X said", "X told the BBC")
+const quoteVerbs = `(?:said|says|added|adds|explained|insisted|warned|claimed|argued|stated|admitted|declared|continued|replied|wrote|tweeted|recalled|noted|told|tells|asked)`
+
+var quotePats = struct {
+	spanPats        []*regexp.Regexp
+	saidName        *regexp.Regexp
+	nameSaid        *regexp.Regexp
+	nameSaidBefore  *regexp.Regexp
+	accordingTo     *regexp.Regexp
+	accordingBefore *regexp.Regexp
+	trailingCredit  *regexp.Regexp
+	handle          *regexp.Regexp
+	citeSel         cascadia.Selector
+	titles          map[string]bool
+	stopWords       map[string]bool
+}{
+	// quoted spans (the quote text is the first group)
+	[]*regexp.Regexp{
+		regexp.MustCompile(`"([^"]+)"`),
+		regexp.MustCompile(`“([^”]+)”`),
+		// single quotes have to dodge apostrophes
+		regexp.MustCompile(`(?:^|[\s(\[—–])‘(.+?)’(?:[^\p{L}\d]|$)`),
+		regexp.MustCompile(`(?:^|[\s(\[—–])'(.+?)'(?:[^\p{L}\d]|$)`),
+	},
+	// after the quote
+	regexp.MustCompile(`^[\s,]*` + quoteVerbsFirst + `\s+(` + quoteNamePat + `)`),
+	regexp.MustCompile(`^[\s,]*(` + quoteNamePat + `|he|she|they|it|we)(?:,[^,"“”]{1,80},)?\s+` + quoteVerbs + `\b`),
+	// before the quote
+	regexp.MustCompile(`(` + quoteNamePat + `|[Hh]e|[Ss]he|[Tt]hey|[Ii]t|[Ww]e)(?:,[^,"“”]{1,80},)?\s+` + quoteVerbs + `\b[^"“”‘.!?]{0,40}?[:,]?\s*$`),
+	regexp.MustCompile(`^[\s,]*according to (` + quoteNamePat + `)`),
+	regexp.MustCompile(`[Aa]ccording to (` + quoteNamePat + `),?\s*$`),
+	// "... — John Smith (@jsmith) June 1, 2020" at the end of a blockquote
+	regexp.MustCompile(`\s(?:—|―|–|--?)\s*([^—―–]{1,80})$`),
+	regexp.MustCompile(`\s*\(@\w+\).*$`),
+	cascadia.MustCompile(`cite, footer`),
+	map[string]bool{"mr": true, "mrs": true, "ms": true, "miss": true, "dr": true, "prof": true, "professor": true,
+		"sir": true, "dame": true, "lord": true, "lady": true, "rev": true},
+	// capitalised words which can start a sentence, but aren't part of a name
+	map[string]bool{"the": true, "a": true, "an": true, "but": true, "and": true, "then": true, "so": true,
+		"yesterday": true, "today": true, "tonight": true, "later": true, "earlier": true, "meanwhile": true,
+		"however": true, "now": true, "last": true, "speaking": true, "also": true, "on": true, "in": true, "at": true,
+		"monday": true, "tuesday": true, "wednesday": true, "thursday": true, "friday": true, "saturday": true, "sunday": true},
+}
+
+// minQuoteWords is the minimum length of a quote without a speaker.
+// (shorter ones are more likely to be scare quotes, titles and the like)
+const minQuoteWords = 4
+
+// quoteSpan is a quoted bit of text within a paragraph. start and end
+// include the quote marks.
+type quoteSpan struct {
+	start, end int
+	txt        string
+}
+
+// grabQuotes finds the direct quotations in the (sanitised) content.
+// Position is the index of the block holding the quote (the first one,
+// for quotes running over several paragraphs).
+func grabQuotes(blocks []contentBlock) []Quote {
+	dbug := Debug.QuotesLogger
+	quotes := []Quote{}
+	speakers := []string{} // in order of appearance
+	var open *Quote        // left unclosed by the previous paragraph
+
+	for pos, b := range blocks {
+		var found []Quote
+		if open != nil && b.Kind != BlockParagraph {
+			found = append(found, *open)
+			open = nil
+		}
+		switch b.Kind {
+		case BlockParagraph:
+			found, open = paragraphQuotes(b.Text, pos, speakers, open)
+			if open != nil && pos == len(blocks)-1 {
+				found = append(found, *open)
+			}
+		case BlockList:
+			for _, item := range strings.Split(b.Text, "\n") {
+				itemQuotes, unclosed := paragraphQuotes(item, pos, speakers, nil)
+				found = append(found, itemQuotes...)
+				if unclosed != nil {
+					found = append(found, *unclosed)
+				}
+			}
+		case BlockQuote:
+			if q, ok := blockquoteQuote(b.nodes[0], speakers); ok {
+				q.Position = pos
+				found = append(found, q)
+			}
+		}
+		for _, q := range found {
+			if q.Speaker != "" && (len(speakers) == 0 || speakers[len(speakers)-1] != q.Speaker) {
+				speakers = append(speakers, q.Speaker)
+			}
+			if q.Speaker == "" && wordCount(q.Text) < minQuoteWords {
+				dbug.Printf("skip %q (too short)\n", q.Text)
+				continue
+			}
+			dbug.Printf("%d: %q: %q\n", q.Position, q.Speaker, snip(q.Text, 40))
+			quotes = append(quotes, q)
+		}
+	}
+	return quotes
+}
+
+// findQuoteSpans returns the quoted bits of txt, in order
+func findQuoteSpans(txt string) []quoteSpan {
+	spans := []quoteSpan{}
+	for _, pat := range quotePats.spanPats {
+		for _, m := range pat.FindAllStringSubmatchIndex(txt, -1) {
+			_, openSize := utf8.DecodeLastRuneInString(txt[:m[2]])
+			_, closeSize := utf8.DecodeRuneInString(txt[m[3]:])
+			spans = append(spans, quoteSpan{start: m[2] - openSize, end: m[3] + closeSize, txt: txt[m[2]:m[3]]})
+		}
+	}
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+
+	// lose any overlaps (eg quotes within quotes)
+	out := []quoteSpan{}
+	for _, s := range spans {
+		if len(out) > 0 && s.start < out[len(out)-1].end {
+			continue
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// paragraphQuotes finds and attributes the quotes within a paragraph.
+// Any quotes without an obvious speaker are credited to the first one
+// found in the paragraph (eg `"Foo," he said. "Bar."`).
+//
+// A quote can run over several paragraphs, with an opening mark at the
+// start of each one but a closing mark only at the very end. open is any
+// quote left unclosed by the previous paragraph, and the returned Quote
+// is one left unclosed by this paragraph (or nil).
+func paragraphQuotes(txt string, pos int, speakers []string, open *Quote) ([]Quote, *Quote) {
+	quotes := []Quote{}
+	first := 0 // the first quote belonging to this paragraph
+	if open != nil {
+		if !strings.HasPrefix(txt, "“") && !strings.HasPrefix(txt, `"`) {
+			// it ended with the previous paragraph
+			quotes = append(quotes, *open)
+			first = 1
+		} else {
+			_, openSize := utf8.DecodeRuneInString(txt)
+			end := strings.IndexAny(txt[openSize:], `”"`)
+			if end < 0 {
+				open.Text += "\n\n" + cleanQuoteText(txt[openSize:])
+				return quotes, open
+			}
+			end += openSize
+			open.Text += "\n\n" + cleanQuoteText(txt[openSize:end])
+			_, closeSize := utf8.DecodeRuneInString(txt[end:])
+			txt = txt[end+closeSize:]
+			if open.Speaker == "" {
+				open.Speaker = attributeQuote("", txt, speakers)
+			}
+			quotes = append(quotes, *open)
+		}
+	}
+
+	spans := findQuoteSpans(txt)
+	paraSpeaker := ""
+	if len(quotes) > first {
+		paraSpeaker = quotes[first].Speaker
+	}
+	for i, s := range spans {
+		prevEnd := 0
+		if i > 0 {
+			prevEnd = spans[i-1].end
+		}
+		nextStart := len(txt)
+		if i < len(spans)-1 {
+			nextStart = spans[i+1].start
+		}
+		q := Quote{Text: cleanQuoteText(s.txt), Position: pos}
+		if q.Text == "" {
+			continue
+		}
+		q.Speaker = attributeQuote(txt[prevEnd:s.start], txt[s.end:nextStart], speakers)
+		if paraSpeaker == "" {
+			paraSpeaker = q.Speaker
+		}
+		quotes = append(quotes, q)
+	}
+	for i := first; i < len(quotes); i++ {
+		if quotes[i].Speaker == "" {
+			quotes[i].Speaker = paraSpeaker
+		}
+	}
+
+	// a quote which carries on into the next paragraph?
+	lastEnd := 0
+	if len(spans) > 0 {
+		lastEnd = spans[len(spans)-1].end
+	}
+	if start, size, ok := unclosedQuote(txt[lastEnd:]); ok {
+		start += lastEnd
+		q := Quote{Text: cleanQuoteText(txt[start+size:]), Position: pos}
+		if q.Text != "" {
+			q.Speaker = attributeQuote(txt[lastEnd:start], "", speakers)
+			return quotes, &q
+		}
+	}
+	return quotes, nil
+}
+
+// unclosedQuote looks for an opening quote mark without a closing one
+// after it. Returns the offset and size of the mark.
+func unclosedQuote(txt string) (int, int, bool) {
+	start, size := -1, 0
+	if i := strings.LastIndex(txt, "“"); i >= 0 && !strings.Contains(txt[i:], "”") {
+		start, size = i, len("“")
+	} else if strings.Count(txt, `"`) == 1 {
+		start, size = strings.Index(txt, `"`), 1
+	}
+	if start < 0 {
+		return 0, 0, false
+	}
+	// must start a word (so not the inches in 6'2")
+	if r, _ := utf8.DecodeLastRuneInString(txt[:start]); start > 0 && !unicode.IsSpace(r) && !strings.ContainsRune("([—–", r) {
+		return 0, 0, false
+	}
+	return start, size, true
+}
+
+// blockquoteQuote treats a whole blockquote as a quote. The speaker comes
+// from any <cite> or <footer>, or a trailing "— Name" credit.
+func blockquoteQuote(n *html.Node, speakers []string) (Quote, bool) {
+	n = cloneNode(n)
+	q := Quote{}
+	if cite := quotePats.citeSel.MatchFirst(n); cite != nil {
+		q.Speaker = compressSpace(getTextContent(cite))
+		cite.Parent.RemoveChild(cite)
+	}
+	txt := compressSpace(getTextContent(n))
+	if q.Speaker == "" {
+		if m := quotePats.trailingCredit.FindStringSubmatchIndex(txt); m != nil {
+			q.Speaker = txt[m[2]:m[3]]
+			txt = txt[:m[0]]
+		}
+	}
+	q.Speaker = strings.Trim(quotePats.handle.ReplaceAllString(q.Speaker, ""), " —―–-,")
+	if name, ok := resolveSpeaker(q.Speaker, speakers); ok {
+		q.Speaker = name
+	}
+	q.Text = cleanQuoteText(strings.Trim(txt, `"“”‘’' `))
+	return q, q.Text != ""
+}
+
+// cleanQuoteText tidies up the text of a quote
+func cleanQuoteText(txt string) string {
+	return strings.TrimRight(strings.TrimSpace(txt), ", ")
+}
+
+// attributeQuote tries to find the speaker of a quote from the text
+// before and after it. Returns "" if nobody obvious.
+func attributeQuote(before string, after string, speakers []string) string {
+	try := []struct {
+		pat *regexp.Regexp
+		txt string
+	}{
+		{quotePats.saidName, after},
+		{quotePats.nameSaid, after},
+		{quotePats.accordingTo, after},
+		{quotePats.nameSaidBefore, before},
+		{quotePats.accordingBefore, before},
+	}
+	for _, t := range try {
+		m := t.pat.FindStringSubmatch(t.txt)
+		if m == nil {
+			continue
+		}
+		if name, ok := resolveSpeaker(m[1], speakers); ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// resolveSpeaker checks that a possible speaker looks like a name, and
+// matches up pronouns and surnames with earlier speakers.
+func resolveSpeaker(raw string, speakers []string) (string, bool) {
+	words := strings.Fields(raw)
+	for len(words) > 0 && quotePats.stopWords[strings.ToLower(words[0])] {
+		words = words[1:]
+	}
+	if len(words) == 0 {
+		return "", false
+	}
+
+	switch strings.ToLower(words[0]) {
+	case "he", "she":
+		if len(words) == 1 && len(speakers) > 0 {
+			return speakers[len(speakers)-1], true
+		}
+		return "", false
+	case "it", "they", "we", "i", "you":
+		return "", false
+	}
+
+	// "Smith" or "Mr Smith" after "John Smith"?
+	title := len(words) == 2 && quotePats.titles[strings.ToLower(strings.TrimSuffix(words[0], "."))]
+	if len(words) == 1 || title {
+		surname := words[len(words)-1]
+		for i := len(speakers) - 1; i >= 0; i-- {
+			parts := strings.Fields(speakers[i])
+			if len(parts) > 1 && parts[len(parts)-1] == surname {
+				return speakers[i], true
+			}
+		}
+	}
+
+	name := strings.Join(words, " ")
+	score := rateName(name)
+	if score < 0 || (score == 0 && len(words) > 1 && !title) {
+		return "", false
+	}
+	return name, true
+}
@@ -0,0 +1,145 @@
+package arts
+
+import (
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+	"strings"
+	"testing"
+)
+
+func TestGrabQuotes(t *testing.T) {
+	root := parseDoc(`<html><body><div id="content">
+<p>The council has approved plans for a new bridge over the river.</p>
+<p>"This is a great day for the town," said Jane Smith, the council leader.</p>
+<p>“We have waited a long time for this,” she added. “It will change everything.”</p>
+<p>Opposition councillor Bob Roberts told the local paper: 'It is a waste of money and nobody asked for it.'</p>
+<p>The so-called "flagship project" is due to open in 2025, according to the council.</p>
+<p>Ms Smith said the work would start in the spring, "weather permitting and all going to plan".</p>
+<blockquote><p>Bridges are the future of transport in this town.</p><footer>— Fred Bloggs</footer></blockquote>
+<p>"I'm not sure about that at all," Mr Roberts said.</p>
+</div></body></html>`)
+
+	content := []*html.Node{cascadia.MustCompile("#content").MatchFirst(root)}
+	got := grabQuotes(splitBlocks(content))
+
+	expected := []Quote{
+		{Speaker: "Jane Smith", Text: "This is a great day for the town", Position: 1},
+		{Speaker: "Jane Smith", Text: "We have waited a long time for this", Position: 2},
+		{Speaker: "Jane Smith", Text: "It will change everything.", Position: 2},
+		{Speaker: "Bob Roberts", Text: "It is a waste of money and nobody asked for it.", Position: 3},
+		{Speaker: "Jane Smith", Text: "weather permitting and all going to plan", Position: 5},
+		{Speaker: "Fred Bloggs", Text: "Bridges are the future of transport in this town.", Position: 6},
+		{Speaker: "Bob Roberts", Text: "I'm not sure about that at all", Position: 7},
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("got %d quotes (expected %d): %+v", len(got), len(expected), got)
+	}
+	for i, q := range got {
+		if q != expected[i] {
+			t.Errorf("got %+v (expected %+v)", q, expected[i])
+		}
+	}
+}
+
+func TestResolveSpeaker(t *testing.T) {
+	speakers := []string{"John Smith", "Sarah Jones"}
+	testData := []struct {
+		raw      string
+		expected string
+		ok       bool
+	}{
+		{"Bob Roberts", "Bob Roberts", true},
+		{"Yesterday Bob Roberts", "Bob Roberts", true},
+		{"she", "Sarah Jones", true},
+		{"Smith", "John Smith", true},
+		{"Mr Smith", "John Smith", true},
+		{"Dr. Jones", "Sarah Jones", true},
+		{"Tesco", "Tesco", true},
+		{"it", "", false},
+		{"The", "", false},
+		{"Follow Us", "", false},
+	}
+	for _, dat := range testData {
+		got, ok := resolveSpeaker(dat.raw, speakers)
+		if got != dat.expected || ok != dat.ok {
+			t.Errorf("resolveSpeaker(%q) = %q,%v (expected %q,%v)", dat.raw, got, ok, dat.expected, dat.ok)
+		}
+	}
+}
+
+func TestMultiParagraphQuotes(t *testing.T) {
+	root := parseDoc(`<html><body><div id="content">
+<p>John Smith said: “We have been working on this for years.</p>
+<p>“Nobody thought it would happen, but here we are.</p>
+<p>“It's a great day,” he added.</p>
+<p>"The first part of another quote,</p>
+<p>"and the last part of it," Jane Jones said.</p>
+<h2>Elsewhere</h2>
+<p>The club said: “We are looking into it and will say more soon.</p>
+<p>Fans were not impressed.</p>
+<p>He was 6'2" tall and played for the club for many years.</p>
+</div></body></html>`)
+
+	content := []*html.Node{cascadia.MustCompile("#content").MatchFirst(root)}
+	got := grabQuotes(splitBlocks(content))
+
+	expected := []Quote{
+		{Speaker: "John Smith", Text: "We have been working on this for years.\n\nNobody thought it would happen, but here we are.\n\nIt's a great day", Position: 0},
+		{Speaker: "Jane Jones", Text: "The first part of another quote\n\nand the last part of it", Position: 3},
+		{Speaker: "", Text: "We are looking into it and will say more soon.", Position: 6},
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("got %d quotes (expected %d): %+v", len(got), len(expected), got)
+	}
+	for i, q := range got {
+		if q != expected[i] {
+			t.Errorf("got %+v (expected %+v)", q, expected[i])
+		}
+	}
+}
+
+// the positions should index into Article.Blocks
+func TestPositionsMatchBlocks(t *testing.T) {
+	src := `<html><head><title>Bridge plans</title></head><body>
+<h1>Bridge plans</h1>
+<div class="article">
+<p>The council has approved plans for a new bridge over the river, at a cost of several million pounds.</p>
+<div class="inner">Some loose text with a <a href="http://www.example.com/news/1-bridge">link</a>, mentioning Jane Smith.
+<p>"This is a great day for the town," said Jane Smith, the council leader, who visited Leeds.</p>
+</div>
+<ul><li>One point about the bridge from the <a href="http://www.example.org/report">report</a></li><li>Another point</li></ul>
+<a href="http://www.example.com/pics/bridge.html"><img src="http://www.example.com/pics/bridge.jpg" alt="the bridge"></a>
+<p>Work is due to start in the spring, and the bridge should open in 2025, according to Jane Smith.</p>
+</div>
+</body></html>`
+
+	art, err := ExtractFromHTMLWithOptions([]byte(src), "http://www.example.com/news/2-bridge-plans", &Options{Blocks: true, Quotes: true, Entities: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inBlock := func(pos int, txt string) bool {
+		return pos >= 0 && pos < len(art.Blocks) && strings.Contains(art.Blocks[pos].Text, txt)
+	}
+	for _, l := range art.Links {
+		want := l.Text
+		if l.URL == "http://www.example.com/pics/bridge.html" {
+			want = "the bridge" // from the alt text
+		}
+		if !inBlock(l.Position, want) {
+			t.Errorf("link %+v not in block %d", l, l.Position)
+		}
+	}
+	if len(art.Links) != 3 {
+		t.Errorf("got %d links (expected 3)", len(art.Links))
+	}
+	if len(art.Quotes) != 1 || !inBlock(art.Quotes[0].Position, art.Quotes[0].Text) {
+		t.Errorf("bad quotes: %+v", art.Quotes)
+	}
+	for _, e := range art.Entities {
+		for _, m := range e.Mentions {
+			if !inBlock(m.Position, m.Text) || !strings.HasPrefix(art.Blocks[m.Position].Text[m.Offset:], m.Text) {
+				t.Errorf("mention %+v of %q not in block %d", m, e.Name, m.Position)
+			}
+		}
+	}
+}
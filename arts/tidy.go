@@ -8,7 +8,149 @@ import (
 	"strings"
 )
 
-// a list of allowed elements and their allowed attrs
+// SanitisePolicy controls which elements and attributes are allowed in the
+// extracted content. Anything else is stripped out.
+type SanitisePolicy struct {
+	// Elements maps the allowed elements to their allowed attrs
+	Elements map[atom.Atom][]atom.Atom
+	// Unwrap holds disallowed elements which should be replaced by their
+	// contents, rather than removed outright (eg <a> for plain text)
+	Unwrap map[atom.Atom]bool
+	// UnwrapUnknown unwraps all disallowed elements (Unwrap is ignored),
+	// except for those in Drop
+	UnwrapUnknown bool
+	// Drop holds the elements which are removed outright when
+	// UnwrapUnknown is set
+	Drop map[atom.Atom]bool
+}
+
+// allows returns true if the element is allowed
+func (policy *SanitisePolicy) allows(a atom.Atom) bool {
+	_, ok := policy.Elements[a]
+	return ok
+}
+
+// unwraps returns true if a disallowed element should be replaced by its
+// contents, rather than removed
+func (policy *SanitisePolicy) unwraps(a atom.Atom) bool {
+	if policy.UnwrapUnknown {
+		return !policy.Drop[a]
+	}
+	return policy.Unwrap[a]
+}
+
+// Clone returns a deep copy of the policy, which can be altered without
+// affecting the original.
+func (policy *SanitisePolicy) Clone() *SanitisePolicy {
+	out := &SanitisePolicy{
+		Elements:      extendElements(policy.Elements, nil),
+		UnwrapUnknown: policy.UnwrapUnknown,
+	}
+	if policy.Unwrap != nil {
+		out.Unwrap = map[atom.Atom]bool{}
+		for a, v := range policy.Unwrap {
+			out.Unwrap[a] = v
+		}
+	}
+	if policy.Drop != nil {
+		out.Drop = map[atom.Atom]bool{}
+		for a, v := range policy.Drop {
+			out.Drop[a] = v
+		}
+	}
+	return out
+}
+
+// DefaultPolicy returns a policy which keeps the structure and simple
+// formatting of the text, plus images, links and tables.
+// Each call returns a fresh copy, free to be altered.
+func DefaultPolicy() *SanitisePolicy {
+	return defaultPolicy.Clone()
+}
+
+// TextPolicy returns a policy which keeps just the text, split into
+// paragraphs, headings, lists and quotes. Links, formatting, containers
+// and anything else unknown are unwrapped. Tables, figures, headers,
+// footers and media are dropped entirely.
+// Intended for feeding into language processing.
+// Each call returns a fresh copy, free to be altered.
+func TextPolicy() *SanitisePolicy {
+	return textPolicy.Clone()
+}
+
+// RichPolicy returns a policy which is DefaultPolicy plus embedded media
+// (video, audio, iframes) and responsive images, with enough attributes
+// left on to display them.
+// Each call returns a fresh copy, free to be altered.
+func RichPolicy() *SanitisePolicy {
+	return richPolicy.Clone()
+}
+
+// the presets (never handed out directly)
+var defaultPolicy = SanitisePolicy{Elements: elementWhitelist}
+
+var textPolicy = SanitisePolicy{
+	Elements: map[atom.Atom][]atom.Atom{
+		atom.P:          {},
+		atom.H1:         {},
+		atom.H2:         {},
+		atom.H3:         {},
+		atom.H4:         {},
+		atom.H5:         {},
+		atom.H6:         {},
+		atom.Ul:         {},
+		atom.Ol:         {},
+		atom.Li:         {},
+		atom.Dl:         {},
+		atom.Dt:         {},
+		atom.Dd:         {},
+		atom.Blockquote: {},
+		atom.Pre:        {},
+		atom.Br:         {},
+	},
+	UnwrapUnknown: true,
+	Drop: map[atom.Atom]bool{
+		atom.Table: true, atom.Figure: true, atom.Header: true, atom.Footer: true,
+		// media
+		atom.Img: true, atom.Picture: true, atom.Video: true, atom.Audio: true, atom.Iframe: true,
+		atom.Embed: true, atom.Object: true, atom.Svg: true, atom.Math: true, atom.Canvas: true, atom.Map: true,
+		// never any article text in these
+		atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true,
+		atom.Button: true, atom.Select: true, atom.Textarea: true,
+	},
+}
+
+var richPolicy = SanitisePolicy{
+	Elements: extendElements(elementWhitelist, map[atom.Atom][]atom.Atom{
+		atom.Blockquote: {atom.Cite},
+		atom.Q:          {atom.Cite},
+		atom.Img:        {atom.Src, atom.Srcset, atom.Sizes, atom.Alt, atom.Width, atom.Height},
+		atom.Picture:    {},
+		atom.Source:     {atom.Src, atom.Srcset, atom.Sizes, atom.Media, atom.Type},
+		atom.Video:      {atom.Src, atom.Poster, atom.Controls, atom.Width, atom.Height},
+		atom.Audio:      {atom.Src, atom.Controls},
+		atom.Track:      {atom.Src, atom.Kind, atom.Srclang, atom.Label},
+		atom.Iframe:     {atom.Src, atom.Width, atom.Height, atom.Title, atom.Allowfullscreen},
+		atom.Td:         {atom.Colspan, atom.Rowspan},
+		atom.Th:         {atom.Colspan, atom.Rowspan, atom.Scope},
+	}),
+}
+
+// extendElements returns a copy of an element map, with some extra (or
+// replacement) entries. The attr lists are copied too, so the policies
+// can be altered independently.
+func extendElements(base map[atom.Atom][]atom.Atom, extra map[atom.Atom][]atom.Atom) map[atom.Atom][]atom.Atom {
+	out := make(map[atom.Atom][]atom.Atom, len(base)+len(extra))
+	for a, attrs := range base {
+		out[a] = append([]atom.Atom{}, attrs...)
+	}
+	for a, attrs := range extra {
+		out[a] = append([]atom.Atom{}, attrs...)
+	}
+	return out
+}
+
+// a list of allowed elements and their allowed attrs, for DefaultPolicy
 // all missing elements or attrs should be stripped
 var elementWhitelist = map[atom.Atom][]atom.Atom{
 	// basing on list at  https://developer.mozilla.org/en-US/docs/Web/Guide/HTML/HTML5/HTML5_element_list
@@ -24,8 +166,8 @@ var elementWhitelist = map[atom.Atom][]atom.Atom{
 	atom.H4:      {},
 	atom.H5:      {},
 	atom.H6:      {},
-	atom.Header:  {}, // should disallow?
-	atom.Footer:  {}, // should disallow?
+	atom.Header:  {}, // (TextPolicy drops these)
+	atom.Footer:  {}, // (TextPolicy drops these)
 	atom.Address: {},
 	//atom.Main?
 
@@ -82,8 +224,7 @@ var elementWhitelist = map[atom.Atom][]atom.Atom{
 
 	//Embedded content
 	atom.Img: {atom.Src, atom.Alt},
-	// atom.Video?
-	// atom.Audio?
+	// (see RichPolicy for video, audio and iframes)
 	// atom.Map?
 	// atom.Area?
 	// atom.Svg?
@@ -107,6 +248,50 @@ var elementWhitelist = map[atom.Atom][]atom.Atom{
 
 }
 
+// AMP custom elements which have standard equivalents
+// (see https://www.ampproject.org/docs/reference/components)
+var ampElements = map[string]atom.Atom{
+	"amp-img":    atom.Img,
+	"amp-anim":   atom.Img,
+	"amp-video":  atom.Video,
+	"amp-audio":  atom.Audio,
+	"amp-iframe": atom.Iframe,
+}
+
+// translateAMPElement converts an AMP custom element (eg <amp-img>) into
+// the standard equivalent (eg <img>).
+// Returns false if n isn't a recognised AMP element.
+func translateAMPElement(n *html.Node) bool {
+	a, ok := ampElements[n.Data]
+	if n.Type != html.ElementNode || !ok {
+		return false
+	}
+	n.Data = a.String()
+	n.DataAtom = a
+
+	// AMP elements can hold placeholder or fallback content (often a
+	// <noscript><img></noscript> for amp-img). Cull it.
+	// <img> is a void element, so it gets nothing.
+	for child := n.FirstChild; child != nil; {
+		next := child.NextSibling
+		if a == atom.Img || child.DataAtom == atom.Noscript ||
+			hasAttr(child, "placeholder") || hasAttr(child, "fallback") {
+			n.RemoveChild(child)
+		}
+		child = next
+	}
+	return true
+}
+
+// unwrapNode replaces n with its children
+func unwrapNode(n *html.Node) {
+	for child := n.FirstChild; child != nil; child = n.FirstChild {
+		n.RemoveChild(child)
+		n.Parent.InsertBefore(child, n)
+	}
+	n.Parent.RemoveChild(n)
+}
+
 func filterAttrs(n *html.Node, fn func(*html.Attribute) bool) {
 	var out = make([]html.Attribute, 0)
 	for _, a := range n.Attr {
@@ -121,8 +306,10 @@ func filterAttrs(n *html.Node, fn func(*html.Attribute) bool) {
 // rendered
 // - remove comments
 // - trim empty text nodes
-// - TODO make links absolute
-func tidyNode(node *html.Node) {
+// - translate AMP elements into standard ones
+// - strip out any elements and attrs not allowed by the policy
+// The node itself is never removed or unwrapped (see sanitiseContent()).
+func tidyNode(node *html.Node, policy *SanitisePolicy) {
 	var commentSel cascadia.Selector = func(n *html.Node) bool {
 		return n.Type == html.CommentNode
 	}
@@ -168,10 +355,15 @@ func tidyNode(node *html.Node) {
 
 	// remove any elements or attrs not on the whitelist
 	for _, n := range elementSel.MatchAll(node) {
-		allowedAttrs, whiteListed := elementWhitelist[n.DataAtom]
-		if !whiteListed {
+		translateAMPElement(n)
+		allowedAttrs, whiteListed := policy.Elements[n.DataAtom]
+		if !whiteListed && n != node {
 			if n.Parent != nil {
-				n.Parent.RemoveChild(n)
+				if policy.unwraps(n.DataAtom) {
+					unwrapNode(n)
+				} else {
+					n.Parent.RemoveChild(n)
+				}
 			}
 			continue
 		}
@@ -0,0 +1,80 @@
+package arts
+
+import (
+	"golang.org/x/net/html/atom"
+	"strings"
+	"testing"
+)
+
+func TestSanitisePolicies(t *testing.T) {
+	para := `<p>The quick brown fox jumps over the <a href="/dogs">lazy dog</a>, <em>again</em>, and again, and again, until the dog gets quite annoyed.</p>`
+	src := `<html><head><title>Foxes and dogs</title></head><body>
+<h1>Foxes and dogs</h1>
+<div class="article">` + para + para + `
+<figure><img src="/pics/fox.jpg" srcset="/pics/fox-2x.jpg 2x" alt="a fox"><figcaption>A fox.</figcaption></figure>
+<table><tr><td>Foxes seen in the garden this year</td><td>12</td></tr><tr><td>Dogs annoyed by foxes this year</td><td>3</td></tr></table>
+<video src="/vids/fox.mp4" poster="/pics/fox.jpg" controls></video>
+<p>The fox was called <fox-name>Basil</fox-name>, and was <del>very</del> quite annoying to the dog next door.</p>
+` + para + `</div>
+</body></html>`
+
+	testData := []struct {
+		name     string
+		policy   *SanitisePolicy
+		expected []string
+		banned   []string
+	}{
+		{"default", nil,
+			[]string{`<a href="http://example.com/dogs">`, "<em>", "<table>", `<img src="http://example.com/pics/fox.jpg" alt="a fox"/>`},
+			[]string{"<video", "srcset"}},
+		{"text", TextPolicy(),
+			[]string{"<p>The quick brown fox jumps over the lazy dog, again, and again", "called Basil, and was very quite"},
+			[]string{"<a", "<em>", "<table>", "<img", "<video", "<div", "<fox-name", "<del", "A fox.", "Foxes"}},
+		{"rich", RichPolicy(),
+			[]string{"<table>", `srcset="http://example.com/pics/fox-2x.jpg 2x"`, `<video src="http://example.com/vids/fox.mp4" poster="http://example.com/pics/fox.jpg" controls="">`},
+			[]string{}},
+	}
+
+	for _, dat := range testData {
+		art, err := ExtractFromHTMLWithOptions([]byte(src), "http://example.com/news/foxes-and-dogs", &Options{Policy: dat.policy})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range dat.expected {
+			if !strings.Contains(art.Content, s) {
+				t.Errorf("%s: missing %q", dat.name, s)
+			}
+		}
+		for _, s := range dat.banned {
+			if strings.Contains(art.Content, s) {
+				t.Errorf("%s: shouldn't contain %q", dat.name, s)
+			}
+		}
+	}
+}
+
+func TestPolicyCopies(t *testing.T) {
+	// altering one copy shouldn't affect any others
+	policy := DefaultPolicy()
+	policy.Elements[atom.Img][0] = atom.Title
+	delete(policy.Elements, atom.Table)
+	clone := policy.Clone()
+	clone.Elements[atom.Img][0] = atom.Width
+	if policy.Elements[atom.Img][0] != atom.Title {
+		t.Errorf("Clone() shares attrs: %v", policy.Elements[atom.Img])
+	}
+	for _, other := range []*SanitisePolicy{DefaultPolicy(), RichPolicy()} {
+		if other.Elements[atom.Img][0] != atom.Src {
+			t.Errorf("img attrs changed: %v", other.Elements[atom.Img])
+		}
+		if _, ok := other.Elements[atom.Table]; !ok {
+			t.Errorf("table removed")
+		}
+	}
+
+	text := TextPolicy()
+	text.Drop[atom.Table] = false
+	if !TextPolicy().Drop[atom.Table] {
+		t.Errorf("TextPolicy() shares Drop")
+	}
+}
@@ -1,12 +1,12 @@
 package arts
 
 // urls.go - code to look for alternate URLs within the HTML
-// (ie canonical, shortlink etc...)
+// (ie canonical, shortlink, amphtml etc...)
 
 import (
 	"github.com/andybalholm/cascadia"
 	"fmt"
-	"github.com/PuerkitoBio/purell"
+	"github.com/bcampbell/arts/util"
 	"golang.org/x/net/html"
 	"net/url"
 )
@@ -15,13 +15,17 @@ var urlSels = struct {
 	relCanonical cascadia.Selector
 	ogUrl        cascadia.Selector
 	relShortlink cascadia.Selector
+	relAMPHTML   cascadia.Selector
+	htmlSel      cascadia.Selector
 }{
 	cascadia.MustCompile(`link[rel="canonical"]`),
 	cascadia.MustCompile(`meta[property="og:url"]`),
 	cascadia.MustCompile(`link[rel="shortlink"]`),
+	cascadia.MustCompile(`link[rel="amphtml"]`),
+	cascadia.MustCompile(`html`),
 }
 
-func sanitiseURL(link string, baseURL *url.URL) (string, error) {
+func sanitiseURL(link string, baseURL *url.URL, canon *util.Canonicaliser) (string, error) {
 	u, err := baseURL.Parse(link)
 	if err != nil {
 		return "", err
@@ -32,12 +36,13 @@ func sanitiseURL(link string, baseURL *url.URL) (string, error) {
 		return "", fmt.Errorf("obviously not article")
 	}
 
-	return purell.NormalizeURL(u, purell.FlagsSafe), nil
+	return canon.Canonicalise(u).String(), nil
 }
 
 // grabUrls looks for rel-canonical, og:url and rel-shortlink urls
 // returns canonical url (or "") and a list of all urls (including baseURL)
-func grabURLs(root *html.Node, baseURL *url.URL) (string, []string) {
+// All the urls are canonicalised using canon.
+func grabURLs(root *html.Node, baseURL *url.URL, canon *util.Canonicaliser) (string, []string) {
 
 	dbug := Debug.URLLogger
 
@@ -45,7 +50,7 @@ func grabURLs(root *html.Node, baseURL *url.URL) (string, []string) {
 	all := make(map[string]struct{})
 
 	// start with base URL
-	u := purell.NormalizeURL(baseURL, purell.FlagsSafe)
+	u := canon.Canonicalise(baseURL).String()
 	if u != "" {
 		all[u] = struct{}{}
 	}
@@ -53,7 +58,7 @@ func grabURLs(root *html.Node, baseURL *url.URL) (string, []string) {
 	// look for canonical urls first
 	for _, link := range urlSels.ogUrl.MatchAll(root) {
 		txt := getAttr(link, "content")
-		u, err := sanitiseURL(txt, baseURL)
+		u, err := sanitiseURL(txt, baseURL, canon)
 		if err != nil {
 			dbug.Printf("Reject og:url %s (%s)\n", txt, err)
 			continue
@@ -65,7 +70,7 @@ func grabURLs(root *html.Node, baseURL *url.URL) (string, []string) {
 	}
 	for _, link := range urlSels.relCanonical.MatchAll(root) {
 		txt := getAttr(link, "href")
-		u, err := sanitiseURL(txt, baseURL)
+		u, err := sanitiseURL(txt, baseURL, canon)
 		if err != nil {
 			dbug.Printf("Reject rel-canonical %s (%s)\n", txt, err)
 			continue
@@ -79,7 +84,7 @@ func grabURLs(root *html.Node, baseURL *url.URL) (string, []string) {
 	// look for other (non-canonical) urls
 	for _, link := range urlSels.relShortlink.MatchAll(root) {
 		txt := getAttr(link, "href")
-		u, err := sanitiseURL(getAttr(link, "href"), baseURL)
+		u, err := sanitiseURL(getAttr(link, "href"), baseURL, canon)
 		if err != nil {
 			dbug.Printf("Reject rel-shortlink %s (%s)\n", txt, err)
 			continue
@@ -96,3 +101,47 @@ func grabURLs(root *html.Node, baseURL *url.URL) (string, []string) {
 
 	return canonical, allList
 }
+
+// isAMP returns true if the document is an AMP page
+// (ie <html amp> or <html ⚡>)
+func isAMP(root *html.Node) bool {
+	el := urlSels.htmlSel.MatchFirst(root)
+	if el == nil {
+		return false
+	}
+	for _, attr := range el.Attr {
+		if attr.Key == "amp" || attr.Key == "⚡" {
+			return true
+		}
+	}
+	return false
+}
+
+// grabAMPURL returns the url of the AMP version of the article (or "").
+// If the page is itself an AMP page, that's the baseURL. Otherwise we look
+// for a rel-amphtml link.
+func grabAMPURL(root *html.Node, baseURL *url.URL, canon *util.Canonicaliser) string {
+	dbug := Debug.URLLogger
+
+	// we want the AMP url here, so don't fold it into the non-AMP one!
+	ampCanon := *canon
+	ampCanon.FoldAMP = false
+	canon = &ampCanon
+
+	if isAMP(root) {
+		dbug.Printf("Page is AMP\n")
+		return canon.Canonicalise(baseURL).String()
+	}
+
+	for _, link := range urlSels.relAMPHTML.MatchAll(root) {
+		txt := getAttr(link, "href")
+		u, err := sanitiseURL(txt, baseURL, canon)
+		if err != nil {
+			dbug.Printf("Reject rel-amphtml %s (%s)\n", txt, err)
+			continue
+		}
+		dbug.Printf("Accept rel-amphtml %s\n", u)
+		return u
+	}
+	return ""
+}
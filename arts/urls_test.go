@@ -1,6 +1,7 @@
 package arts
 
 import (
+	"github.com/bcampbell/arts/util"
 	"golang.org/x/net/html"
 	"net/url"
 	"sort"
@@ -63,7 +64,7 @@ func TestGrabURLs(t *testing.T) {
 			panic(err)
 		}
 
-		canonical, all := grabURLs(root, srcUrl)
+		canonical, all := grabURLs(root, srcUrl, &util.DefaultCanonicaliser)
 
 		if canonical != expected.canonical {
 			t.Errorf(`bad canonical (got "%s" expected "%s")`, canonical, expected.canonical)
@@ -86,3 +87,47 @@ func TestGrabURLs(t *testing.T) {
 		}
 	}
 }
+
+// TestGrabAMPURL tests the grabAMPURL() function
+func TestGrabAMPURL(t *testing.T) {
+	testData := []struct {
+		rawHTML string
+		srcURL  string
+		expect  string
+	}{
+		// no amp
+		{`<html><head></head><body></body></html>`,
+			"http://example.com/fook",
+			"",
+		},
+		// non-amp page, pointing to amp version
+		{`<html><head><link rel="amphtml" href="/fook/amp" /></head><body></body></html>`,
+			"http://example.com/fook",
+			"http://example.com/fook/amp",
+		},
+		// amp page
+		{`<html amp><head><link rel="canonical" href="http://example.com/fook" /></head><body></body></html>`,
+			"http://example.com/fook/amp",
+			"http://example.com/fook/amp",
+		},
+		{`<html ⚡><head></head><body></body></html>`,
+			"http://example.com/fook/amp",
+			"http://example.com/fook/amp",
+		},
+	}
+
+	for _, dat := range testData {
+		srcURL, err := url.Parse(dat.srcURL)
+		if err != nil {
+			panic(err)
+		}
+		root, err := html.Parse(strings.NewReader(dat.rawHTML))
+		if err != nil {
+			panic(err)
+		}
+		got := grabAMPURL(root, srcURL, &util.DefaultCanonicaliser)
+		if got != dat.expect {
+			t.Errorf(`grabAMPURL() got "%s" (expected "%s")`, got, dat.expect)
+		}
+	}
+}
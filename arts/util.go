@@ -91,6 +91,17 @@ func walkChildren(root *html.Node, fn func(*html.Node)) {
 	}
 }
 
+// matchFirstDescendant is like sel.MatchFirst(root), but never returns
+// root itself
+func matchFirstDescendant(root *html.Node, sel cascadia.Selector) *html.Node {
+	for child := root.FirstChild; child != nil; child = child.NextSibling {
+		if n := sel.MatchFirst(child); n != nil {
+			return n
+		}
+	}
+	return nil
+}
+
 //
 func closest(n *html.Node, sel cascadia.Selector) *html.Node {
 	for n != nil {
@@ -134,6 +145,16 @@ func getAttr(n *html.Node, attr string) string {
 	return ""
 }
 
+// hasAttr returns true if the node has the named attribute (even if empty)
+func hasAttr(n *html.Node, attr string) bool {
+	for _, a := range n.Attr {
+		if a.Key == attr {
+			return true
+		}
+	}
+	return false
+}
+
 // getTextContent recursively fetches the text for a node
 func getTextContent(n *html.Node) string {
 	if n.Type == html.TextNode {
@@ -198,6 +219,23 @@ func describeNode(n *html.Node) string {
 	return "???" // not an element
 }
 
+// cloneNode returns a deep copy of n. The copy is detached (ie has no
+// parent or siblings).
+func cloneNode(n *html.Node) *html.Node {
+	out := &html.Node{
+		Type:      n.Type,
+		DataAtom:  n.DataAtom,
+		Data:      n.Data,
+		Namespace: n.Namespace,
+		Attr:      make([]html.Attribute, len(n.Attr)),
+	}
+	copy(out.Attr, n.Attr)
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		out.AppendChild(cloneNode(child))
+	}
+	return out
+}
+
 // dumpTree is a debug helper to display a tree of nodes
 func dumpTree(n *html.Node, depth int) {
 	fmt.Printf("%s%s\n", strings.Repeat(" ", depth), describeNode(n))
@@ -163,6 +163,19 @@ func parseDoc(src string) *html.Node {
 	return doc
 }
 
+// testParaText is long enough and has enough commas to score as article
+// text
+const testParaText = `The quick brown fox jumps over the lazy dog, again, and again, and again, until the dog gets quite annoyed.`
+
+// testPara returns a paragraph of article text, with txt (if any) at the
+// start so tests can tell which paragraphs ended up where
+func testPara(txt string) string {
+	if txt != "" {
+		txt += " "
+	}
+	return `<p>` + txt + testParaText + `</p>`
+}
+
 func TestNextElement(t *testing.T) {
 
 	cases := []struct {
@@ -3,22 +3,23 @@ package discover
 //
 //
 // TODO:
-//   should be able to guess article link format statistically
-//   handle/allow subdomains (eg: www1.politicalbetting.com)
-//   filter unwanted navlinks (eg "mirror.co.uk/all-about/fred bloggs")
 //   HTTP error handling
-//   multiple url formats (eg spectator has multiple cms's)
 //   logging
 
 import (
+	"context"
 	"github.com/andybalholm/cascadia"
 	"golang.org/x/net/html"
+	"github.com/bcampbell/arts/util"
+	"golang.org/x/net/publicsuffix"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"regexp"
 	"strings"
+	"sync"
+	"time"
 )
 
 type Logger interface {
@@ -44,28 +45,182 @@ type DiscovererDef struct {
 	// if empty, reject everything on a different domain
 	HostPat string
 
+	// SameDomain accepts any host under the registrable domain of the
+	// start URL (eg www1.politicalbetting.com for www.politicalbetting.com).
+	// Ignored if HostPat is set.
+	SameDomain bool
+
+	// StartURLs are additional pages to start crawling from (eg the
+	// front pages of other subdomains)
+	StartURLs []string
+
+	// HostGroups allow different article url formats on different hosts
+	// (eg sites running multiple CMSes on separate subdomains).
+	// Links on hosts not covered by a group are matched against ArtPat.
+	HostGroups []HostGroupDef
+
 	// If NoStripQuery is set then article URLs won't have the query part zapped
 	NoStripQuery bool
+	// KeepParams are query keys which are never zapped (eg an article id)
+	KeepParams []string
+	// TrackingParams are regexes matching extra query keys to remove from
+	// article URLs, on top of util.DefaultTrackingParams
+	TrackingParams []string
+	// FoldAMP turns AMP article URLs into their non-AMP form
+	FoldAMP bool
+	// FoldMobileHosts maps m., mobile. and amp. hosts onto www.
+	FoldMobileHosts bool
+	// HostAliases maps hosts onto their canonical form
+	HostAliases map[string]string
+	// TrailingSlash is the policy for article URLs: "keep" (the default),
+	// "strip" or "add"
+	TrailingSlash string
+
+	// NavInclude is a list of regexes. If set, only nav links matching one
+	// of them are followed (and NavFilter doesn't apply to them).
+	NavInclude []string
+	// NavExclude is a list of regexes matching nav links not to follow.
+	// It takes precedence over NavInclude.
+	NavExclude []string
+	// If NavFilter is set, nav links which look like tag, author, search,
+	// paginated or archive pages are automatically skipped.
+	NavFilter bool
+
+	// Workers is the number of nav pages to fetch and scan concurrently.
+	// Defaults to 1.
+	Workers int
+	// QueueSize is the maximum number of nav pages waiting to be picked up
+	// by workers. Defaults to Workers.
+	QueueSize int
+
+	// MaxNavPages is the maximum number of nav pages to fetch (0=no limit).
+	// The same limit applies separately to sitemaps found via robots.txt
+	// and sitemap indexes.
+	MaxNavPages int
+	// MaxDepth is the maximum number of nav links to follow away from the
+	// start page (0=no limit)
+	MaxDepth int
+	// Timeout is the overall time budget for a crawl (0=no limit)
+	Timeout time.Duration
+
+	// Feeds is a list of RSS or Atom feeds to take article links from
+	Feeds []string
+	// Sitemaps is a list of sitemap.xml files (or sitemap indexes) to take
+	// article links from. Google News sitemaps are supported.
+	Sitemaps []string
+	// AutoFeeds turns on autodiscovery of feeds (via <link rel="alternate">
+	// on nav pages) and sitemaps (via robots.txt)
+	AutoFeeds bool
+}
+
+// HostGroupDef defines the article url formats for a set of hosts
+type HostGroupDef struct {
+	// HostPat is a regex matching the hosts in the group
+	HostPat string
+	ArtPat  []string
+}
+
+type hostGroup struct {
+	hostPat *regexp.Regexp
+	artPats []*regexp.Regexp
+}
+
+// StopReason describes why a crawl stopped
+type StopReason int
+
+const (
+	// StopFinished - ran out of nav pages to visit
+	StopFinished StopReason = iota
+	// StopMaxNavPages - hit the MaxNavPages limit
+	StopMaxNavPages
+	// StopTimeout - ran out of time (Timeout)
+	StopTimeout
+	// StopCancelled - the context was cancelled (or hit its deadline)
+	StopCancelled
+	// StopErrorThreshold - too many HTTP errors
+	StopErrorThreshold
+	// StopError - some other error
+	StopError
+)
+
+func (r StopReason) String() string {
+	switch r {
+	case StopFinished:
+		return "finished"
+	case StopMaxNavPages:
+		return "max nav pages reached"
+	case StopTimeout:
+		return "timeout"
+	case StopCancelled:
+		return "cancelled"
+	case StopErrorThreshold:
+		return "error threshold exceeded"
+	case StopError:
+		return "error"
+	}
+	return "unknown"
 }
 
 type DiscoverStats struct {
+	// ErrorCount is the number of nav pages which couldn't be fetched.
+	// Failed feeds, sitemaps and robots.txt are logged, but aren't counted
+	// (they're optional extras, and often just guesses).
 	ErrorCount int
 	FetchCount int
+	// NotModifiedCount is the number of fetches which came back with
+	// "304 Not Modified" (included in FetchCount)
+	NotModifiedCount int
+	// NewCount is the number of articles not seen on previous runs (only
+	// counted if there's a State)
+	NewCount int
+	// DisallowedCount is the number of fetches refused because of robots.txt
+	// (see util.RobotsTripper). They don't count as errors.
+	DisallowedCount int
+	// NavSkipped counts the (distinct) nav links not followed, by reason
+	NavSkipped map[SkipReason]int
+	// StopReason is why the last run stopped
+	StopReason StopReason
 }
 
 type Discoverer struct {
 	Name               string
 	StartURL           url.URL
+	StartURLs          []url.URL // all the start pages, including StartURL (if empty, just StartURL)
 	ArtPats            []*regexp.Regexp
+	HostGroups         []hostGroup
 	NavLinkSel         cascadia.Selector
 	BaseErrorThreshold int
-	StripFragments     bool
-	StripQuery         bool
+	URLRules           util.Canonicaliser // for tidying up article URLs
 	HostPat            *regexp.Regexp
+	Domain             string // registrable domain to accept (if no HostPat)
+	NavInclude         []*regexp.Regexp
+	NavExclude         []*regexp.Regexp
+	NavFilter          bool
+	Workers            int
+	QueueSize          int
+	MaxNavPages        int
+	MaxDepth           int
+	Timeout            time.Duration
+	Feeds              []url.URL
+	Sitemaps           []url.URL
+	AutoFeeds          bool
+
+	// StripFragments and StripQuery override URLRules.StripFragment and
+	// URLRules.StripQuery (they predate URLRules, and are kept for
+	// compatibility)
+	StripFragments bool
+	StripQuery     bool
+
+	// State, if set, is used to remember things between runs. Run will
+	// only return articles which weren't found by previous runs.
+	// It's only updated (and committed) if the run succeeds.
+	State StateStore
 
 	ErrorLog Logger
 	InfoLog  Logger
-	Stats    DiscoverStats
+	// Stats is only updated by the goroutine calling Run(), so there's no
+	// need to lock it.
+	Stats DiscoverStats
 }
 
 func NewDiscoverer(cfg DiscovererDef) (*Discoverer, error) {
@@ -76,13 +231,28 @@ func NewDiscoverer(cfg DiscovererDef) (*Discoverer, error) {
 	}
 	disc.Name = cfg.Name
 	disc.StartURL = *u
-	disc.ArtPats = make([]*regexp.Regexp, 0, len(cfg.ArtPat))
-	for _, pat := range cfg.ArtPat {
-		re, err := regexp.Compile(pat)
+	disc.StartURLs = []url.URL{*u}
+	for _, start := range cfg.StartURLs {
+		u, err := disc.StartURL.Parse(start)
 		if err != nil {
 			return nil, err
 		}
-		disc.ArtPats = append(disc.ArtPats, re)
+		disc.StartURLs = append(disc.StartURLs, *u)
+	}
+	disc.ArtPats, err = compilePats(cfg.ArtPat)
+	if err != nil {
+		return nil, err
+	}
+	for _, groupDef := range cfg.HostGroups {
+		hostPat, err := regexp.Compile(groupDef.HostPat)
+		if err != nil {
+			return nil, err
+		}
+		artPats, err := compilePats(groupDef.ArtPat)
+		if err != nil {
+			return nil, err
+		}
+		disc.HostGroups = append(disc.HostGroups, hostGroup{hostPat, artPats})
 	}
 
 	if cfg.NavSel == "" {
@@ -95,6 +265,26 @@ func NewDiscoverer(cfg DiscovererDef) (*Discoverer, error) {
 		disc.NavLinkSel = sel
 	}
 	disc.BaseErrorThreshold = cfg.BaseErrorThreshold
+	disc.Workers = cfg.Workers
+	disc.QueueSize = cfg.QueueSize
+	disc.MaxNavPages = cfg.MaxNavPages
+	disc.MaxDepth = cfg.MaxDepth
+	disc.Timeout = cfg.Timeout
+	for _, feed := range cfg.Feeds {
+		u, err := disc.StartURL.Parse(feed)
+		if err != nil {
+			return nil, err
+		}
+		disc.Feeds = append(disc.Feeds, *u)
+	}
+	for _, sitemap := range cfg.Sitemaps {
+		u, err := disc.StartURL.Parse(sitemap)
+		if err != nil {
+			return nil, err
+		}
+		disc.Sitemaps = append(disc.Sitemaps, *u)
+	}
+	disc.AutoFeeds = cfg.AutoFeeds
 
 	if cfg.HostPat != "" {
 		re, err := regexp.Compile(cfg.HostPat)
@@ -103,77 +293,504 @@ func NewDiscoverer(cfg DiscovererDef) (*Discoverer, error) {
 		}
 		disc.HostPat = re
 	}
+	disc.NavInclude, err = compilePats(cfg.NavInclude)
+	if err != nil {
+		return nil, err
+	}
+	disc.NavExclude, err = compilePats(cfg.NavExclude)
+	if err != nil {
+		return nil, err
+	}
+	disc.NavFilter = cfg.NavFilter
+	if cfg.SameDomain {
+		disc.Domain, err = publicsuffix.EffectiveTLDPlusOne(disc.StartURL.Hostname())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	disc.URLRules = util.Canonicaliser{
+		StripFragment:   true,
+		StripQuery:      !cfg.NoStripQuery,
+		StripTracking:   true,
+		KeepParams:      cfg.KeepParams,
+		FoldAMP:         cfg.FoldAMP,
+		FoldMobileHosts: cfg.FoldMobileHosts,
+		HostAliases:     cfg.HostAliases,
+	}
+	disc.StripFragments = disc.URLRules.StripFragment
+	disc.StripQuery = disc.URLRules.StripQuery
+	if len(cfg.TrackingParams) > 0 {
+		extra, err := compilePats(cfg.TrackingParams)
+		if err != nil {
+			return nil, err
+		}
+		disc.URLRules.TrackingParams = append(append([]*regexp.Regexp{}, util.DefaultTrackingParams...), extra...)
+	}
+	switch cfg.TrailingSlash {
+	case "", "keep":
+		disc.URLRules.TrailingSlash = util.SlashKeep
+	case "strip":
+		disc.URLRules.TrailingSlash = util.SlashStrip
+	case "add":
+		disc.URLRules.TrailingSlash = util.SlashAdd
+	default:
+		return nil, fmt.Errorf("bad TrailingSlash (%s)", cfg.TrailingSlash)
+	}
 
 	// defaults
-	disc.StripFragments = true
-	disc.StripQuery = !cfg.NoStripQuery
 	disc.ErrorLog = NullLogger{}
 	disc.InfoLog = NullLogger{}
 	return disc, nil
 }
 
-func (disc *Discoverer) Run(client *http.Client) (LinkSet, error) {
-	// reset stats
-	disc.Stats = DiscoverStats{}
+func compilePats(pats []string) ([]*regexp.Regexp, error) {
+	out := make([]*regexp.Regexp, 0, len(pats))
+	for _, pat := range pats {
+		re, err := regexp.Compile(pat)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, re)
+	}
+	return out, nil
+}
 
-	queued := make(LinkSet) // nav pages to scan for article links
-	seen := make(LinkSet)   // nav pages we've scanned
-	arts := make(LinkSet)   // article links we've found so far
+// jobKind is the type of page a worker is asked to fetch
+type jobKind int
 
-	queued.Add(disc.StartURL)
+const (
+	navJob     jobKind = iota // html nav page
+	feedJob                   // RSS or Atom feed
+	sitemapJob                // sitemap.xml (or sitemap index)
+	robotsJob                 // robots.txt (to look for sitemaps)
+)
 
-	for len(queued) > 0 {
-		pageURL := queued.Pop()
-		seen.Add(pageURL)
-		//
+type job struct {
+	kind jobKind
+	u    url.URL
+	prev *PageState // from the last run (if any), for conditional GETs
+}
 
-		root, err := disc.fetchAndParse(client, &pageURL)
-		if err != nil {
-			disc.ErrorLog.Printf("%s\n", err.Error())
-			disc.Stats.ErrorCount++
-			if disc.Stats.ErrorCount > disc.BaseErrorThreshold+(disc.Stats.FetchCount/10) {
-				return nil, errors.New("Error threshold exceeded")
-			} else {
-				continue
+// jobResult holds the outcome of a single job
+type jobResult struct {
+	job
+	fetchErr    error // failed to fetch/parse the page
+	err         error // something more fatal
+	notModified bool  // page unchanged since last run
+	disallowed  bool  // blocked by robots.txt
+	validators  PageState
+	navLinks    LinkSet
+	navSkipped  map[url.URL]SkipReason
+	arts        []*Link
+	feeds       []url.URL // feeds discovered
+	sitemaps    []url.URL // sitemaps discovered
+}
+
+var errNotModified = errors.New("not modified")
+
+// fetchFailed records a failed fetch (which might just mean the page hasn't
+// changed since last time, or that robots.txt says no)
+func (res *jobResult) fetchFailed(err error) {
+	if err == errNotModified {
+		res.notModified = true
+	} else if util.IsDisallowed(err) {
+		res.disallowed = true
+	} else {
+		res.fetchErr = err
+	}
+}
+
+// setValidators remembers the ETag and Last-Modified of a response
+func (res *jobResult) setValidators(resp *http.Response) {
+	res.validators.ETag = resp.Header.Get("ETag")
+	res.validators.LastModified = resp.Header.Get("Last-Modified")
+}
+
+// Run crawls the site, starting at StartURLs and following nav links, and
+// returns all the article links found, in the order they were first seen.
+// If there's a State, only articles not seen on previous runs are returned.
+func (disc *Discoverer) Run(client *http.Client) ([]*Link, error) {
+	return disc.RunContext(context.Background(), client)
+}
+
+// RunContext is like Run, but can be cancelled via the context.
+// The crawl stops when it runs out of nav pages, hits one of the limits
+// (MaxNavPages, Timeout), is cancelled or encounters too many errors.
+// The reason is recorded in Stats.StopReason, and the article links found
+// so far are always returned (even if there's an error). State isn't
+// updated by a failed run, so its articles will be returned again next
+// time.
+//
+// Pages are fetched and scanned by a pool of Workers goroutines, but
+// all the bookkeeping (queue, stats, logging) happens in the calling
+// goroutine.
+func (disc *Discoverer) RunContext(ctx context.Context, client *http.Client) (arts []*Link, err error) {
+	// reset stats
+	disc.Stats = DiscoverStats{NavSkipped: map[SkipReason]int{}}
+	// changes to State, only made if the run succeeds (otherwise the
+	// articles would never be returned)
+	newPages := map[url.URL]PageState{}
+	newArts := []url.URL{}
+	if disc.State != nil {
+		defer func() {
+			if err != nil {
+				return
+			}
+			for u, ps := range newPages {
+				disc.State.SetPage(u, ps)
+			}
+			for _, u := range newArts {
+				disc.State.AddArticle(u)
 			}
+			err = disc.State.Commit()
+		}()
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if disc.Timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		runCtx, cancelTimeout = context.WithTimeout(runCtx, disc.Timeout)
+		defer cancelTimeout()
+	}
+
+	workers := disc.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	queueSize := disc.QueueSize
+	if queueSize < 1 {
+		queueSize = workers
+	}
+
+	jobs := make(chan job, queueSize)
+	results := make(chan jobResult)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				results <- disc.doJob(runCtx, client, j)
+			}
+		}()
+	}
+
+	inFlight := 0
+	// shutdown stops the workers, discarding any outstanding results
+	shutdown := func() {
+		cancel()
+		close(jobs)
+		for ; inFlight > 0; inFlight-- {
+			<-results
 		}
-		disc.Stats.FetchCount++
+		wg.Wait()
+	}
+	// interrupted stops the workers after a timeout or cancellation
+	interrupted := func() error {
+		shutdown()
+		if ctx.Err() != nil {
+			disc.Stats.StopReason = StopCancelled
+			return ctx.Err()
+		}
+		disc.Stats.StopReason = StopTimeout
+		disc.InfoLog.Printf("Timeout after %s\n", disc.Timeout)
+		return nil
+	}
 
-		navLinks, err := disc.findNavLinks(root)
-		if err != nil {
-			return nil, err
+	queued := make(LinkSet)      // nav pages to scan for article links
+	seen := make(LinkSet)        // nav pages we've scanned (or are scanning)
+	skipped := make(LinkSet)     // nav links we've decided not to follow
+	arts = []*Link{}             // (new) article links found so far, in order
+	found := map[url.URL]*Link{} // article links found so far, by url
+	depths := map[url.URL]int{}  // distance of nav pages from a start page
+	dispatched := 0              // number of nav pages handed out
+	xmlQueued := []job{}         // feeds, sitemaps etc to fetch
+	xmlSeen := make(LinkSet)     // feeds, sitemaps etc already queued
+	extraSitemaps := 0           // sitemaps found via robots.txt or sitemap indexes
+
+	for _, start := range disc.startURLs() {
+		queued.Add(start)
+		depths[start] = 0
+	}
+
+	queueXML := func(kind jobKind, u url.URL) {
+		if _, got := xmlSeen[u]; got {
+			return
 		}
-		for navLink, _ := range navLinks {
-			if _, got := seen[navLink]; !got {
-				queued.Add(navLink)
-			}
+		xmlSeen.Add(u)
+		xmlQueued = append(xmlQueued, job{kind: kind, u: u})
+	}
+	for _, u := range disc.Feeds {
+		queueXML(feedJob, u)
+	}
+	for _, u := range disc.Sitemaps {
+		queueXML(sitemapJob, u)
+	}
+	if disc.AutoFeeds {
+		for _, start := range disc.startURLs() {
+			robots, _ := start.Parse("/robots.txt")
+			queueXML(robotsJob, *robots)
 		}
+	}
 
-		foo, err := disc.findArticles(&pageURL, root)
-		if err != nil {
-			return nil, err
+	var next job // next job to hand out
+	haveNext := false
+	for len(queued) > 0 || len(xmlQueued) > 0 || haveNext || inFlight > 0 {
+		limited := disc.MaxNavPages > 0 && dispatched >= disc.MaxNavPages
+		if !haveNext && len(xmlQueued) > 0 {
+			next = xmlQueued[0]
+			xmlQueued = xmlQueued[1:]
+			haveNext = true
 		}
-		arts.Merge(foo)
+		if !haveNext && len(queued) > 0 && !limited {
+			next = job{kind: navJob, u: queued.Pop()}
+			seen.Add(next.u)
+			haveNext = true
+		}
+		if haveNext && next.prev == nil && disc.State != nil {
+			if ps, got := disc.State.Page(next.u); got {
+				next.prev = &ps
+			}
+		}
+		var jobChan chan job // nil (ie never ready) unless there's work to hand out
+		if haveNext {
+			jobChan = jobs
+		}
+		if limited && !haveNext && inFlight == 0 {
+			break
+		}
+
+		select {
+		case <-runCtx.Done():
+			return arts, interrupted()
+		case jobChan <- next:
+			haveNext = false
+			inFlight++
+			if next.kind == navJob {
+				dispatched++
+			}
+		case res := <-results:
+			inFlight--
+			if res.disallowed {
+				disc.InfoLog.Printf("Disallowed by robots.txt: %s\n", res.u.String())
+				disc.Stats.DisallowedCount++
+				continue
+			}
+			if res.fetchErr != nil {
+				if runCtx.Err() != nil {
+					// not the page's fault
+					return arts, interrupted()
+				}
+				disc.ErrorLog.Printf("%s\n", res.fetchErr.Error())
+				if res.kind != navJob {
+					// feeds, sitemaps etc are optional
+					continue
+				}
+				disc.Stats.ErrorCount++
+				if disc.Stats.ErrorCount > disc.BaseErrorThreshold+(disc.Stats.FetchCount/10) {
+					shutdown()
+					disc.Stats.StopReason = StopErrorThreshold
+					return arts, errors.New("Error threshold exceeded")
+				}
+				continue
+			}
+			disc.Stats.FetchCount++
+			if res.err != nil {
+				shutdown()
+				disc.Stats.StopReason = StopError
+				return arts, res.err
+			}
 
-		disc.InfoLog.Printf("Visited %s, found %d articles\n", pageURL.String(), len(foo))
+			if res.notModified {
+				// carry on with the links we found last time
+				disc.Stats.NotModifiedCount++
+				res.navLinks = make(LinkSet)
+				for _, u := range parseURLs(res.prev.NavLinks) {
+					res.navLinks.Add(u)
+				}
+				res.feeds = parseURLs(res.prev.Feeds)
+				res.sitemaps = parseURLs(res.prev.Sitemaps)
+			} else if disc.State != nil && (res.validators.ETag != "" || res.validators.LastModified != "") {
+				ps := res.validators
+				navLinks := []url.URL{}
+				for u, _ := range res.navLinks {
+					navLinks = append(navLinks, u)
+				}
+				ps.NavLinks = urlStrings(navLinks)
+				ps.Feeds = urlStrings(res.feeds)
+				ps.Sitemaps = urlStrings(res.sitemaps)
+				newPages[res.u] = ps
+			}
+
+			for navLink, reason := range res.navSkipped {
+				if _, got := skipped[navLink]; got {
+					continue
+				}
+				skipped.Add(navLink)
+				disc.Stats.NavSkipped[reason]++
+			}
+
+			depth := depths[res.u] + 1
+			for navLink, _ := range res.navLinks {
+				if _, got := seen[navLink]; got {
+					continue
+				}
+				if disc.MaxDepth > 0 && depth > disc.MaxDepth {
+					continue
+				}
+				if _, got := depths[navLink]; !got {
+					depths[navLink] = depth
+				}
+				queued.Add(navLink)
+			}
+			for _, u := range res.feeds {
+				queueXML(feedJob, u)
+			}
+			for _, u := range res.sitemaps {
+				// sitemap indexes can list thousands of sitemaps, so
+				// MaxNavPages applies to them too
+				if !disc.isHostGood(u.Host) {
+					continue
+				}
+				if _, got := xmlSeen[u]; got {
+					continue
+				}
+				if disc.MaxNavPages > 0 && extraSitemaps >= disc.MaxNavPages {
+					disc.InfoLog.Printf("Skipping sitemap %s (MaxNavPages reached)\n", u.String())
+					continue
+				}
+				queueXML(sitemapJob, u)
+				extraSitemaps++
+			}
+			newCnt := 0
+			for _, l := range res.arts {
+				if prev, got := found[l.URL]; got {
+					prev.merge(l)
+					continue
+				}
+				found[l.URL] = l
+				if disc.State != nil {
+					if disc.State.SeenArticle(l.URL) {
+						continue
+					}
+					newArts = append(newArts, l.URL)
+					disc.Stats.NewCount++
+				}
+				arts = append(arts, l)
+				newCnt++
+			}
+
+			if res.notModified {
+				disc.InfoLog.Printf("Visited %s, not modified\n", res.u.String())
+			} else {
+				disc.InfoLog.Printf("Visited %s, found %d articles (%d new)\n", res.u.String(), len(res.arts), newCnt)
+			}
+		}
 	}
 
+	shutdown()
+	if len(queued) > 0 {
+		disc.Stats.StopReason = StopMaxNavPages
+		disc.InfoLog.Printf("Stopped after %d nav pages\n", dispatched)
+	} else {
+		disc.Stats.StopReason = StopFinished
+	}
 	return arts, nil
 }
 
-func (disc *Discoverer) fetchAndParse(client *http.Client, pageURL *url.URL) (*html.Node, error) {
-	resp, err := client.Get(pageURL.String())
+// doJob performs a single job.
+// Called from worker goroutines, so it mustn't touch any shared state.
+func (disc *Discoverer) doJob(ctx context.Context, client *http.Client, j job) jobResult {
+	switch j.kind {
+	case feedJob, sitemapJob:
+		return disc.scanXML(ctx, client, j)
+	case robotsJob:
+		return disc.scanRobots(ctx, client, j)
+	}
+	return disc.scanNavPage(ctx, client, j)
+}
+
+// scanNavPage fetches a nav page and picks out the nav and article links.
+func (disc *Discoverer) scanNavPage(ctx context.Context, client *http.Client, j job) jobResult {
+	res := jobResult{job: j}
+	pageURL := j.u
+	resp, err := disc.fetch(ctx, client, &pageURL, j.prev)
 	if err != nil {
-		return nil, err
+		res.fetchFailed(err)
+		return res
 	}
 	defer resp.Body.Close()
+	res.setValidators(resp)
+
+	root, err := html.Parse(resp.Body)
+	if err != nil {
+		res.fetchErr = err
+		return res
+	}
+
+	res.navLinks, res.navSkipped, err = disc.findNavLinks(&pageURL, root)
+	if err != nil {
+		res.err = err
+		return res
+	}
+
+	res.arts, err = disc.findArticles(&pageURL, root)
+	if err != nil {
+		res.err = err
+		return res
+	}
+
+	if disc.AutoFeeds {
+		res.feeds = disc.findFeedLinks(&pageURL, root)
+	}
+	return res
+}
+
+// fetch performs a GET request, returning an error for non-2xx responses.
+// If prev is set, a conditional GET is used and errNotModified is returned
+// if the page hasn't changed.
+// The caller is responsible for closing the response body.
+func (disc *Discoverer) fetch(ctx context.Context, client *http.Client, pageURL *url.URL, prev *PageState) (*http.Response, error) {
+	req, err := http.NewRequest("GET", pageURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if prev != nil {
+		if prev.ETag != "" {
+			req.Header.Set("If-None-Match", prev.ETag)
+		}
+		if prev.LastModified != "" {
+			req.Header.Set("If-Modified-Since", prev.LastModified)
+		}
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && prev != nil {
+		resp.Body.Close()
+		return nil, errNotModified
+	}
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		resp.Body.Close()
 		err = errors.New(fmt.Sprintf("HTTP code %d (%s)", resp.StatusCode, pageURL.String()))
 
 		return nil, err
 
 	}
+	return resp, nil
+}
+
+func (disc *Discoverer) fetchAndParse(ctx context.Context, client *http.Client, pageURL *url.URL) (*html.Node, error) {
+	resp, err := disc.fetch(ctx, client, pageURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
 
 	root, err := html.Parse(resp.Body)
 	if err != nil {
@@ -185,14 +802,35 @@ func (disc *Discoverer) fetchAndParse(client *http.Client, pageURL *url.URL) (*h
 
 var aSel cascadia.Selector = cascadia.MustCompile("a")
 
-func (disc *Discoverer) findArticles(baseURL *url.URL, root *html.Node) (LinkSet, error) {
-	arts := make(LinkSet)
-	for _, a := range aSel.MatchAll(root) {
+// findArticles returns the article links on a page, in order of appearance.
+func (disc *Discoverer) findArticles(baseURL *url.URL, root *html.Node) ([]*Link, error) {
+	arts := []*Link{}
+	found := map[url.URL]*Link{}
+
+	// canonicalise each link just the once (describeLink needs to look at
+	// the links around each one)
+	anchors := aSel.MatchAll(root)
+	artURLs := map[*html.Node]*url.URL{}
+	for _, a := range anchors {
 		u, err := disc.CookArticleURL(baseURL, GetAttr(a, "href"))
 		if err != nil {
 			continue
 		}
-		arts[*u] = true
+		artURLs[a] = u
+	}
+
+	for _, a := range anchors {
+		u, ok := artURLs[a]
+		if !ok {
+			continue
+		}
+		l := disc.describeLink(baseURL, a, artURLs, len(arts))
+		if prev, got := found[*u]; got {
+			prev.merge(l)
+			continue
+		}
+		found[*u] = l
+		arts = append(arts, l)
 	}
 	return arts, nil
 }
@@ -204,54 +842,86 @@ func (disc *Discoverer) CookArticleURL(baseURL *url.URL, artLink string) (*url.U
 		return nil, err
 	}
 
+	// apply our sanitising rules for this site (first, so that mobile and
+	// AMP links are checked in their canonical form)
+	u = disc.canonicalise(u)
+
 	// on a host we accept?
 	if !disc.isHostGood(u.Host) {
 		return nil, fmt.Errorf("host rejected (%s)", u.Host)
 	}
 
 	// matches one of our url forms
-	foo := u.RequestURI()
-	accept := false
-	for _, pat := range disc.ArtPats {
-		if pat.MatchString(foo) {
-			accept = true
-			break
-		}
-	}
-	if !accept {
+	if !disc.matchesArtPat(u) {
 		return nil, fmt.Errorf("url rejected")
 	}
 
-	// apply our sanitising rules for this site
-	if disc.StripFragments {
-		u.Fragment = ""
+	return u, nil
+}
+
+// canonicalise tidies up an article url using URLRules (along with
+// StripFragments and StripQuery)
+func (disc *Discoverer) canonicalise(u *url.URL) *url.URL {
+	rules := disc.URLRules
+	rules.StripFragment = disc.StripFragments
+	rules.StripQuery = disc.StripQuery
+	return rules.Canonicalise(u)
+}
+
+// artPatsFor returns the article url forms which apply to a host
+func (disc *Discoverer) artPatsFor(host string) []*regexp.Regexp {
+	for _, group := range disc.HostGroups {
+		if group.hostPat.MatchString(host) {
+			return group.artPats
+		}
 	}
-	if disc.StripQuery {
-		u.RawQuery = ""
+	return disc.ArtPats
+}
+
+// matchesArtPat returns true if the url matches one of our article url forms
+func (disc *Discoverer) matchesArtPat(u *url.URL) bool {
+	foo := u.RequestURI()
+	for _, pat := range disc.artPatsFor(u.Host) {
+		if pat.MatchString(foo) {
+			return true
+		}
 	}
-	return u, nil
+	return false
 }
 
-func (disc *Discoverer) findNavLinks(root *html.Node) (LinkSet, error) {
+// findNavLinks picks out the nav links on a page. Relative links are
+// resolved against pageURL.
+// Returns the links to follow, and those skipped (with the reason).
+func (disc *Discoverer) findNavLinks(pageURL *url.URL, root *html.Node) (LinkSet, map[url.URL]SkipReason, error) {
 	navLinks := make(LinkSet)
+	skipped := map[url.URL]SkipReason{}
 	if disc.NavLinkSel == nil {
-		return navLinks, nil
+		return navLinks, skipped, nil
 	}
 	for _, a := range disc.NavLinkSel.MatchAll(root) {
-		link, err := disc.StartURL.Parse(GetAttr(a, "href"))
+		link, err := pageURL.Parse(GetAttr(a, "href"))
 		if err != nil {
 			continue
 		}
 
-		if !disc.isHostGood(link.Host) {
+		link.Fragment = ""
+
+		if reason, ok := disc.checkNavLink(link); !ok {
+			skipped[*link] = reason
 			continue
 		}
 
-		link.Fragment = ""
-
 		navLinks[*link] = true
 	}
-	return navLinks, nil
+	return navLinks, skipped, nil
+}
+
+// startURLs returns the pages to start crawling from
+func (disc *Discoverer) startURLs() []url.URL {
+	if len(disc.StartURLs) == 0 {
+		return []url.URL{disc.StartURL}
+	}
+	return disc.StartURLs
 }
 
 // is host domain one we'll accept?
@@ -259,7 +929,24 @@ func (disc *Discoverer) isHostGood(host string) bool {
 	if disc.HostPat != nil {
 		return disc.HostPat.MatchString(host)
 	}
-	return host == disc.StartURL.Host
+	for _, group := range disc.HostGroups {
+		if group.hostPat.MatchString(host) {
+			return true
+		}
+	}
+	if disc.Domain != "" {
+		hostname := (&url.URL{Host: host}).Hostname()
+		domain, err := publicsuffix.EffectiveTLDPlusOne(hostname)
+		if err == nil && domain == disc.Domain {
+			return true
+		}
+	}
+	for _, start := range disc.startURLs() {
+		if host == start.Host {
+			return true
+		}
+	}
+	return false
 }
 
 // GetAttr retrieved the value of an attribute on a node.
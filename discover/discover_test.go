@@ -0,0 +1,353 @@
+package discover
+
+import (
+	"context"
+	"fmt"
+	"github.com/andybalholm/cascadia"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// linkPaths returns the (sorted) paths of a list of links, for comparing
+// crawls where the order isn't fixed
+func linkPaths(links []*Link) []string {
+	out := []string{}
+	for _, l := range links {
+		out = append(out, l.URL.Path)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func checkPaths(t *testing.T, what string, links []*Link, expected []string) {
+	got := linkPaths(links)
+	sort.Strings(expected)
+	if strings.Join(got, " ") != strings.Join(expected, " ") {
+		t.Errorf("%s: got %v (expected %v)", what, got, expected)
+	}
+}
+
+// treeSite serves an endless tree of nav pages: each page links to two
+// more, and has a single article on it
+func treeSite(delay time.Duration) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		p := strings.Trim(r.URL.Path, "/")
+		fmt.Fprintf(w, `<html><body><nav><a href="/%sa">a</a><a href="/%sb">b</a></nav>
+<a href="/news/%s-story">story</a></body></html>`, p, p, p)
+	}))
+}
+
+func TestRun(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/bad" {
+			http.Error(w, "nope", 500)
+			return
+		}
+		p := strings.Trim(r.URL.Path, "/")
+		fmt.Fprintf(w, `<html><body><nav><a href="/s1">s1</a><a href="/s2">s2</a><a href="/s3">s3</a><a href="/bad">bad</a></nav>
+<a href="/news/%s-1-story">one</a><a href="/news/%s-2-story?q=1#f">two</a><a href="/about">about</a></body></html>`, p, p)
+	}))
+	defer srv.Close()
+
+	expected := []string{"/news/-1-story", "/news/-2-story",
+		"/news/s1-1-story", "/news/s1-2-story",
+		"/news/s2-1-story", "/news/s2-2-story",
+		"/news/s3-1-story", "/news/s3-2-story"}
+	for _, workers := range []int{1, 4} {
+		disc, err := NewDiscoverer(DiscovererDef{
+			Name:               "test",
+			URL:                srv.URL + "/",
+			ArtPat:             []string{`^/news/`},
+			NavSel:             "nav a",
+			BaseErrorThreshold: 5,
+			Workers:            workers,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		arts, err := disc.Run(srv.Client())
+		if err != nil {
+			t.Errorf("workers=%d: %s", workers, err)
+		}
+		checkPaths(t, fmt.Sprintf("workers=%d", workers), arts, expected)
+		for _, l := range arts {
+			if l.URL.RawQuery != "" || l.URL.Fragment != "" {
+				t.Errorf("workers=%d: %s not canonicalised", workers, l.URL.String())
+			}
+		}
+		if disc.Stats.FetchCount != 4 || disc.Stats.ErrorCount != 1 || disc.Stats.StopReason != StopFinished {
+			t.Errorf("workers=%d: bad stats %+v", workers, disc.Stats)
+		}
+	}
+}
+
+func TestErrorThreshold(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.Error(w, "nope", 404)
+			return
+		}
+		fmt.Fprintf(w, `<nav><a href="/s1">s1</a><a href="/s2">s2</a></nav><a href="/news/a-story">a</a>`)
+	}))
+	defer srv.Close()
+
+	disc, err := NewDiscoverer(DiscovererDef{Name: "test", URL: srv.URL + "/", ArtPat: []string{`^/news/`}, NavSel: "nav a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	arts, err := disc.Run(srv.Client())
+	if err == nil {
+		t.Errorf("expected an error")
+	}
+	if disc.Stats.StopReason != StopErrorThreshold {
+		t.Errorf("got StopReason %s (expected %s)", disc.Stats.StopReason, StopErrorThreshold)
+	}
+	// the articles found so far are still returned
+	checkPaths(t, "arts", arts, []string{"/news/a-story"})
+}
+
+func TestOptionalFetchErrors(t *testing.T) {
+	// no robots.txt, and a feed which doesn't exist
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.Error(w, "nope", 404)
+			return
+		}
+		fmt.Fprintf(w, `<html><head><link rel="alternate" type="application/rss+xml" href="/rss"></head>
+<body><a href="/news/a-story">a</a></body></html>`)
+	}))
+	defer srv.Close()
+
+	disc, err := NewDiscoverer(DiscovererDef{
+		Name:      "test",
+		URL:       srv.URL + "/",
+		ArtPat:    []string{`^/news/`},
+		Feeds:     []string{"/feed.xml"},
+		Sitemaps:  []string{"/sitemap.xml"},
+		AutoFeeds: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	arts, err := disc.Run(srv.Client())
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	checkPaths(t, "arts", arts, []string{"/news/a-story"})
+	if disc.Stats.ErrorCount != 0 || disc.Stats.StopReason != StopFinished {
+		t.Errorf("bad stats %+v", disc.Stats)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	srv := treeSite(0)
+	defer srv.Close()
+
+	testData := []struct {
+		def        DiscovererDef
+		fetchCount int
+		stop       StopReason
+	}{
+		// 1+2+4 pages
+		{DiscovererDef{MaxDepth: 2}, 7, StopFinished},
+		{DiscovererDef{MaxNavPages: 5}, 5, StopMaxNavPages},
+		{DiscovererDef{MaxNavPages: 5, Workers: 3}, 5, StopMaxNavPages},
+		{DiscovererDef{MaxNavPages: 10, MaxDepth: 1, Workers: 2}, 3, StopFinished},
+	}
+	for _, dat := range testData {
+		def := dat.def
+		def.Name = "test"
+		def.URL = srv.URL + "/"
+		def.ArtPat = []string{`^/news/`}
+		def.NavSel = "nav a"
+		disc, err := NewDiscoverer(def)
+		if err != nil {
+			t.Fatal(err)
+		}
+		arts, err := disc.Run(srv.Client())
+		if err != nil {
+			t.Errorf("%+v: %s", dat.def, err)
+		}
+		if disc.Stats.FetchCount != dat.fetchCount || disc.Stats.StopReason != dat.stop {
+			t.Errorf("%+v: got %d fetches, %s (expected %d, %s)", dat.def,
+				disc.Stats.FetchCount, disc.Stats.StopReason, dat.fetchCount, dat.stop)
+		}
+		if len(arts) != dat.fetchCount {
+			t.Errorf("%+v: got %d articles (expected %d)", dat.def, len(arts), dat.fetchCount)
+		}
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	srv := treeSite(20 * time.Millisecond)
+	defer srv.Close()
+
+	disc, err := NewDiscoverer(DiscovererDef{Name: "test", URL: srv.URL + "/", ArtPat: []string{`^/news/`}, NavSel: "nav a",
+		Workers: 2, Timeout: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	arts, err := disc.Run(srv.Client())
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	// fetches cut short by the timeout aren't errors
+	if disc.Stats.StopReason != StopTimeout || disc.Stats.ErrorCount != 0 {
+		t.Errorf("bad stats %+v", disc.Stats)
+	}
+	if len(arts) == 0 {
+		t.Errorf("no articles found before the timeout")
+	}
+}
+
+func TestCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			// cancel the crawl while the page is being fetched
+			cancel()
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+			return
+		}
+		fmt.Fprintf(w, `<nav><a href="/s1">s1</a><a href="/s2">s2</a></nav><a href="/news/a-story">a</a>`)
+	}))
+	defer srv.Close()
+
+	disc, err := NewDiscoverer(DiscovererDef{Name: "test", URL: srv.URL + "/", ArtPat: []string{`^/news/`}, NavSel: "nav a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	arts, err := disc.RunContext(ctx, srv.Client())
+	if err != context.Canceled {
+		t.Errorf("got error %v (expected %v)", err, context.Canceled)
+	}
+	if disc.Stats.StopReason != StopCancelled || disc.Stats.ErrorCount != 0 {
+		t.Errorf("bad stats %+v", disc.Stats)
+	}
+	checkPaths(t, "arts", arts, []string{"/news/a-story"})
+}
+
+// multiHostClient sends requests for any host to srv
+func multiHostClient(srv *httptest.Server) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return net.Dial("tcp", srv.Listener.Addr().String())
+		},
+	}}
+}
+
+func TestHostGroups(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Host {
+		case "www.example.com":
+			fmt.Fprintf(w, `<nav><a href="/politics">p</a><a href="http://www1.example.com/blog/">blog</a><a href="http://www.elsewhere.com/">x</a></nav>
+<a href="/news/a-story">a</a><a href="/archives/nope">x</a><a href="http://www.elsewhere.com/news/nope">x</a>`)
+		case "www1.example.com":
+			fmt.Fprintf(w, `<nav><a href="older">older</a></nav><a href="/archives/2017/b-story">b</a><a href="/news/nope">x</a>`)
+		case "spectator.example.org":
+			fmt.Fprintf(w, `<a href="/news/c-story">c</a>`)
+		default:
+			http.Error(w, "bad host", 404)
+		}
+	}))
+	defer srv.Close()
+
+	disc, err := NewDiscoverer(DiscovererDef{
+		Name:       "test",
+		URL:        "http://www.example.com/",
+		StartURLs:  []string{"http://spectator.example.org/"},
+		SameDomain: true,
+		ArtPat:     []string{`^/news/`},
+		NavSel:     "nav a",
+		HostGroups: []HostGroupDef{{HostPat: `^www1\.`, ArtPat: []string{`^/archives/`}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	arts, err := disc.Run(multiHostClient(srv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, l := range arts {
+		got = append(got, l.URL.String())
+	}
+	sort.Strings(got)
+	expected := []string{
+		"http://spectator.example.org/news/c-story",
+		"http://www.example.com/news/a-story",
+		"http://www1.example.com/archives/2017/b-story",
+	}
+	if strings.Join(got, " ") != strings.Join(expected, " ") {
+		t.Errorf("got %v (expected %v)", got, expected)
+	}
+	if disc.Stats.ErrorCount != 0 || disc.Stats.NavSkipped[SkipHost] != 1 {
+		t.Errorf("bad stats %+v", disc.Stats)
+	}
+}
+
+func TestIsHostGood(t *testing.T) {
+	testData := []struct {
+		def      DiscovererDef
+		host     string
+		expected bool
+	}{
+		{DiscovererDef{URL: "http://www.example.com/"}, "www.example.com", true},
+		{DiscovererDef{URL: "http://www.example.com/"}, "www1.example.com", false},
+		{DiscovererDef{URL: "http://www.example.com/", SameDomain: true}, "www1.example.com", true},
+		{DiscovererDef{URL: "http://www.example.com/", SameDomain: true}, "www.example.co.uk", false},
+		{DiscovererDef{URL: "http://www.example.co.uk/", SameDomain: true}, "blogs.example.co.uk", true},
+		{DiscovererDef{URL: "http://www.example.co.uk/", SameDomain: true}, "www.other.co.uk", false},
+		{DiscovererDef{URL: "http://www.example.com/", StartURLs: []string{"http://blog.example.net/"}}, "blog.example.net", true},
+		{DiscovererDef{URL: "http://www.example.com/", HostGroups: []HostGroupDef{{HostPat: `^blogs\.`}}}, "blogs.example.net", true},
+		// HostPat overrides everything else
+		{DiscovererDef{URL: "http://www.example.com/", HostPat: `^news\.`, SameDomain: true}, "www1.example.com", false},
+		{DiscovererDef{URL: "http://www.example.com/", HostPat: `^news\.`}, "news.example.net", true},
+	}
+	for _, dat := range testData {
+		disc, err := NewDiscoverer(dat.def)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := disc.isHostGood(dat.host)
+		if got != dat.expected {
+			t.Errorf("%+v: isHostGood(%s) = %v (expected %v)", dat.def, dat.host, got, dat.expected)
+		}
+	}
+}
+
+func TestStartURLOnly(t *testing.T) {
+	srv := treeSite(0)
+	defer srv.Close()
+
+	// built by hand, without StartURLs
+	u, _ := url.Parse(srv.URL + "/")
+	disc := &Discoverer{
+		StartURL:   *u,
+		ArtPats:    []*regexp.Regexp{regexp.MustCompile(`^/news/`)},
+		NavLinkSel: cascadia.MustCompile("nav a"),
+		MaxDepth:   1,
+		ErrorLog:   NullLogger{},
+		InfoLog:    NullLogger{},
+	}
+	if !disc.isHostGood(u.Host) {
+		t.Errorf("start host %s rejected", u.Host)
+	}
+	arts, err := disc.Run(srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPaths(t, "arts", arts, []string{"/news/-story", "/news/a-story", "/news/b-story"})
+}
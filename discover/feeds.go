@@ -0,0 +1,264 @@
+package discover
+
+// feeds.go - article links from RSS/Atom feeds and sitemaps.
+// Supports:
+//   RSS 2.0, RSS 1.0 (RDF), Atom
+//   sitemap.xml, sitemap indexes, Google News sitemaps (optionally gzipped)
+//
+// Feeds and sitemaps can be autodiscovered via
+// <link rel="alternate" type="application/rss+xml"> on nav pages, and
+// "Sitemap:" lines in robots.txt
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var feedLinkSel cascadia.Selector = cascadia.MustCompile(`link[rel~="alternate"][type="application/rss+xml"], link[rel~="alternate"][type="application/atom+xml"]`)
+
+var robotsSitemapPat = regexp.MustCompile(`(?i)^\s*sitemap\s*:\s*(\S+)`)
+
+// RSS 2.0 and RSS 1.0 (RDF)
+type rssItem struct {
+	Title   string `xml:"title"`
+	Link    string `xml:"link"`
+	PubDate string `xml:"pubDate"`
+	DCDate  string `xml:"http://purl.org/dc/elements/1.1/ date"`
+}
+
+type rssDoc struct {
+	Items []rssItem `xml:"channel>item"`
+}
+
+type rdfDoc struct {
+	Items []rssItem `xml:"item"`
+}
+
+// Atom
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+}
+
+type atomEntry struct {
+	Title     string     `xml:"title"`
+	Links     []atomLink `xml:"link"`
+	Published string     `xml:"published"`
+	Updated   string     `xml:"updated"`
+}
+
+type atomFeed struct {
+	Entries []atomEntry `xml:"entry"`
+}
+
+// sitemaps
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+	News    struct {
+		Title           string `xml:"title"`
+		PublicationDate string `xml:"publication_date"`
+	} `xml:"news"`
+}
+
+type urlSet struct {
+	URLs []sitemapURL `xml:"url"`
+}
+
+type sitemapIndex struct {
+	Sitemaps []struct {
+		Loc string `xml:"loc"`
+	} `xml:"sitemap"`
+}
+
+// findFeedLinks returns any RSS/Atom feeds advertised by a page
+func (disc *Discoverer) findFeedLinks(pageURL *url.URL, root *html.Node) []url.URL {
+	feeds := []url.URL{}
+	for _, link := range feedLinkSel.MatchAll(root) {
+		u, err := pageURL.Parse(GetAttr(link, "href"))
+		if err != nil {
+			continue
+		}
+		if !disc.isHostGood(u.Host) {
+			continue
+		}
+		feeds = append(feeds, *u)
+	}
+	return feeds
+}
+
+// scanRobots looks for sitemaps listed in robots.txt
+func (disc *Discoverer) scanRobots(ctx context.Context, client *http.Client, j job) jobResult {
+	res := jobResult{job: j}
+	resp, err := disc.fetch(ctx, client, &j.u, j.prev)
+	if err != nil {
+		res.fetchFailed(err)
+		return res
+	}
+	defer resp.Body.Close()
+	res.setValidators(resp)
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		m := robotsSitemapPat.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+		u, err := j.u.Parse(m[1])
+		if err != nil {
+			continue
+		}
+		res.sitemaps = append(res.sitemaps, *u)
+	}
+	if err := scanner.Err(); err != nil {
+		res.fetchErr = err
+	}
+	return res
+}
+
+// scanXML fetches a feed or sitemap and extracts the article links. Sites
+// aren't always precise about which is which, so we just go by the root
+// element. Sitemap indexes return their child sitemaps for fetching.
+func (disc *Discoverer) scanXML(ctx context.Context, client *http.Client, j job) jobResult {
+	res := jobResult{job: j, arts: []*Link{}}
+	resp, err := disc.fetch(ctx, client, &j.u, j.prev)
+	if err != nil {
+		res.fetchFailed(err)
+		return res
+	}
+	defer resp.Body.Close()
+	res.setValidators(resp)
+
+	// sitemaps are often gzipped (and not via Content-Encoding)
+	var r io.Reader = bufio.NewReader(resp.Body)
+	magic, _ := r.(*bufio.Reader).Peek(2)
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			res.fetchErr = err
+			return res
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	dec := xml.NewDecoder(r)
+	dec.CharsetReader = charset.NewReaderLabel
+	dec.Strict = false
+
+	// find the root element
+	var start xml.StartElement
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			res.fetchErr = err
+			return res
+		}
+		if el, ok := tok.(xml.StartElement); ok {
+			start = el
+			break
+		}
+	}
+
+	found := map[url.URL]bool{}
+	add := func(link string, l *Link) {
+		u, err := j.u.Parse(strings.TrimSpace(link))
+		if err != nil {
+			return
+		}
+		u = disc.canonicalise(u)
+		if !disc.isHostGood(u.Host) {
+			return
+		}
+		// feeds and sitemaps are already lists of articles, so only apply
+		// the article patterns if we've got them
+		if len(disc.artPatsFor(u.Host)) > 0 && !disc.matchesArtPat(u) {
+			return
+		}
+		if found[*u] {
+			return
+		}
+		found[*u] = true
+		l.URL = *u
+		l.Source = j.u
+		l.Position = len(res.arts)
+		res.arts = append(res.arts, l)
+	}
+
+	switch start.Name.Local {
+	case "rss":
+		var doc rssDoc
+		err = dec.DecodeElement(&doc, &start)
+		addRSSItems(doc.Items, add)
+	case "RDF":
+		var doc rdfDoc
+		err = dec.DecodeElement(&doc, &start)
+		addRSSItems(doc.Items, add)
+	case "feed":
+		var doc atomFeed
+		err = dec.DecodeElement(&doc, &start)
+		for _, entry := range doc.Entries {
+			for _, link := range entry.Links {
+				if link.Rel == "" || link.Rel == "alternate" {
+					add(link.Href, &Link{
+						Text:     CompressSpace(entry.Title),
+						DateHint: strings.TrimSpace(entry.Published),
+						LastMod:  strings.TrimSpace(entry.Updated),
+					})
+					break
+				}
+			}
+		}
+	case "urlset":
+		var doc urlSet
+		err = dec.DecodeElement(&doc, &start)
+		for _, item := range doc.URLs {
+			add(item.Loc, &Link{
+				Text:     CompressSpace(item.News.Title),
+				DateHint: strings.TrimSpace(item.News.PublicationDate),
+				LastMod:  strings.TrimSpace(item.LastMod),
+			})
+		}
+	case "sitemapindex":
+		var doc sitemapIndex
+		err = dec.DecodeElement(&doc, &start)
+		for _, sm := range doc.Sitemaps {
+			u, err := j.u.Parse(strings.TrimSpace(sm.Loc))
+			if err != nil {
+				continue
+			}
+			res.sitemaps = append(res.sitemaps, *u)
+		}
+	default:
+		res.fetchErr = fmt.Errorf("unrecognised feed format <%s> (%s)", start.Name.Local, j.u.String())
+		return res
+	}
+	if err != nil {
+		res.fetchErr = err
+	}
+	return res
+}
+
+func addRSSItems(items []rssItem, add func(string, *Link)) {
+	for _, item := range items {
+		published := strings.TrimSpace(item.PubDate)
+		if published == "" {
+			published = strings.TrimSpace(item.DCDate)
+		}
+		add(item.Link, &Link{
+			Text:     CompressSpace(item.Title),
+			DateHint: published,
+		})
+	}
+}
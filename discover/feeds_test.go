@@ -0,0 +1,144 @@
+package discover
+
+import (
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestFeeds(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "User-agent: *\nSitemap: /sitemap-index.xml\n")
+	})
+	mux.HandleFunc("/sitemap-index.xml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+ <sitemap><loc>/news.xml.gz</loc></sitemap>
+</sitemapindex>`)
+	})
+	mux.HandleFunc("/news.xml.gz", func(w http.ResponseWriter, r *http.Request) {
+		gz := gzip.NewWriter(w)
+		fmt.Fprintf(gz, `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9" xmlns:news="http://www.google.com/schemas/sitemap-news/0.9">
+ <url>
+  <loc>http://%s/news/sitemap-story</loc>
+  <lastmod>2017-01-02</lastmod>
+  <news:news>
+   <news:publication_date>2017-01-01T10:00:00Z</news:publication_date>
+   <news:title>Sitemap story</news:title>
+  </news:news>
+ </url>
+</urlset>`, r.Host)
+		gz.Close()
+	})
+	mux.HandleFunc("/rss", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="ISO-8859-1"?>
+<rss version="2.0"><channel><title>Test</title>
+ <item><title>RSS  story</title><link>/news/rss-story?utm_source=rss</link><pubDate>Mon, 02 Jan 2017 10:00:00 GMT</pubDate></item>
+ <item><title>Elsewhere</title><link>http://elsewhere.com/news/nope</link></item>
+ <item><title>Not an article</title><link>/about</link></item>
+</channel></rss>`)
+	})
+	mux.HandleFunc("/atom", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<feed xmlns="http://www.w3.org/2005/Atom">
+ <entry><title>Atom story</title><link rel="self" href="/atom/1"/><link rel="alternate" href="/news/atom-story"/><updated>2017-01-03</updated></entry>
+</feed>`)
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<html><head><link rel="alternate" type="application/atom+xml" href="/atom"></head>
+<body><a href="/news/page-story">Page story</a></body></html>`)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	disc, err := NewDiscoverer(DiscovererDef{
+		Name:      "test",
+		URL:       srv.URL + "/",
+		ArtPat:    []string{`^/news/`},
+		Feeds:     []string{"/rss"},
+		AutoFeeds: true,
+		Workers:   3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	arts, err := disc.Run(srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]Link{
+		"/news/page-story":    {Text: "Page story"},
+		"/news/rss-story":     {Text: "RSS story", DateHint: "Mon, 02 Jan 2017 10:00:00 GMT"},
+		"/news/atom-story":    {Text: "Atom story", LastMod: "2017-01-03"},
+		"/news/sitemap-story": {Text: "Sitemap story", DateHint: "2017-01-01T10:00:00Z", LastMod: "2017-01-02"},
+	}
+	if len(arts) != len(expected) {
+		t.Fatalf("got %v (expected %d articles)", linkPaths(arts), len(expected))
+	}
+	for _, l := range arts {
+		exp, got := expected[l.URL.Path]
+		if !got {
+			t.Errorf("unexpected article %s", l.URL.String())
+			continue
+		}
+		if l.URL.RawQuery != "" || l.Text != exp.Text || l.DateHint != exp.DateHint || l.LastMod != exp.LastMod {
+			t.Errorf("%s: got %+v (expected %+v)", l.URL.Path, *l, exp)
+		}
+	}
+}
+
+func TestSitemapIndexLimits(t *testing.T) {
+	var mu sync.Mutex
+	fetched := []string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetched = append(fetched, r.URL.Path)
+		mu.Unlock()
+		switch {
+		case r.URL.Path == "/robots.txt":
+			fmt.Fprintf(w, "Sitemap: http://elsewhere.com/sitemap.xml\nSitemap: /sitemap-index.xml\n")
+		case r.URL.Path == "/sitemap-index.xml":
+			fmt.Fprintf(w, `<sitemapindex>`)
+			for i := 0; i < 20; i++ {
+				fmt.Fprintf(w, `<sitemap><loc>/sitemap-%d.xml</loc></sitemap>`, i)
+			}
+			fmt.Fprintf(w, `<sitemap><loc>http://elsewhere.com/sitemap-x.xml</loc></sitemap></sitemapindex>`)
+		case strings.HasPrefix(r.URL.Path, "/sitemap-"):
+			fmt.Fprintf(w, `<urlset><url><loc>/news%s-story</loc></url></urlset>`, strings.TrimSuffix(r.URL.Path, ".xml"))
+		default:
+			fmt.Fprintf(w, `<html><body></body></html>`)
+		}
+	}))
+	defer srv.Close()
+
+	disc, err := NewDiscoverer(DiscovererDef{
+		Name:        "test",
+		URL:         srv.URL + "/",
+		ArtPat:      []string{`^/news/`},
+		AutoFeeds:   true,
+		MaxNavPages: 3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// send everything to srv, so any foreign sitemaps would show up
+	arts, err := disc.Run(multiHostClient(srv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the index itself, plus two of its children
+	if len(arts) != 2 {
+		t.Errorf("got %d articles (expected 2): %v", len(arts), linkPaths(arts))
+	}
+	for _, p := range fetched {
+		if p == "/sitemap.xml" || p == "/sitemap-x.xml" {
+			t.Errorf("fetched sitemap on another host")
+		}
+	}
+}
@@ -0,0 +1,419 @@
+package discover
+
+// infer.go - guess a site's article link format (and nav links) statistically.
+//
+// The same-host links on a set of nav pages are clustered by path shape, eg:
+//   /news/uk-politics-39483784       => /L/slugid
+//   /2017/06/08/election-night-live  => /year/num/num/slug
+//   /sport/football                  => /L/L
+// Clusters with article-like features (slugs, numeric ids, dates) become
+// ArtPat candidates. Links which look like section pages are used to find
+// the container holding the site navigation, which gives the NavSel.
+
+import (
+	"context"
+	"fmt"
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Page is a parsed nav page, for inference
+type Page struct {
+	URL  url.URL
+	Root *html.Node
+}
+
+// Candidate is a proposed ArtPat regex or NavSel selector
+type Candidate struct {
+	Pattern  string
+	Score    float64
+	Matches  int      // number of distinct links matched
+	Examples []string // a few of the matching links
+}
+
+// Inference holds the results of guessing the link formats of a site
+type Inference struct {
+	StartURL url.URL
+	ArtPats  []Candidate // best first
+	NavSels  []Candidate // best first
+}
+
+// segment kinds
+const (
+	segLiteral = iota
+	segYear
+	segNum
+	segID
+	segDate
+	segSlug
+	segSlugID
+	segPage
+)
+
+var inferPats = struct {
+	year        *regexp.Regexp
+	num         *regexp.Regexp
+	id          *regexp.Regexp
+	date        *regexp.Regexp
+	slug        *regexp.Regexp
+	slugID      *regexp.Regexp
+	page        *regexp.Regexp
+	navClassPat *regexp.Regexp
+	maxExamples int
+	minMatches  int
+	maxLiterals int
+}{
+	regexp.MustCompile(`^(?:19|20)\d\d$`),
+	regexp.MustCompile(`^\d{1,4}$`),
+	regexp.MustCompile(`^\d{5,}$`),
+	regexp.MustCompile(`^(?:19|20)\d\d-?\d\d-?\d\d$`),
+	regexp.MustCompile(`^[^-_]+[-_][^-_]+[-_].+$`),
+	regexp.MustCompile(`(?i)^[^/]*[a-z][^/]*\d{4,}[^/]*$|^\d{4,}[-_][^/]+$`),
+	regexp.MustCompile(`(?i)\.(s?html?|php|aspx?|cms)$`),
+	// nav-ish class/id (whole words, or the end of one, as in "topnav",
+	// but not "canvas")
+	regexp.MustCompile(`(?i)(?:^|[\s_-])(?:[a-z]*nav(?:bar|igation)?|[a-z]*menu|header|sections?|topics)(?:[\s_-]|$)`),
+	// number of examples to keep for each candidate
+	3,
+	// need this many links to propose an ArtPat/NavSel
+	3,
+	// max distinct literal values before a segment is generalised
+	3,
+}
+
+// regexes and article-ness scores for each segment kind
+var segRegexes = map[int]string{
+	segYear:   `\d{4}`,
+	segNum:    `\d{1,4}`,
+	segID:     `\d{5,}`,
+	segDate:   `\d{4}-?\d\d-?\d\d`,
+	segSlug:   `[^/]*[-_][^/]*[-_][^/]*`,
+	segSlugID: `[^/]*\d{4,}[^/]*`,
+}
+
+var segScores = map[int]float64{
+	segYear:   1,
+	segNum:    0.5,
+	segID:     3,
+	segDate:   2,
+	segSlug:   3,
+	segSlugID: 4,
+	segPage:   2,
+}
+
+// classifySegment works out what sort of thing a path segment is
+func classifySegment(seg string) int {
+	switch {
+	case inferPats.date.MatchString(seg):
+		return segDate
+	case inferPats.year.MatchString(seg):
+		return segYear
+	case inferPats.num.MatchString(seg):
+		return segNum
+	case inferPats.id.MatchString(seg):
+		return segID
+	case inferPats.page.MatchString(seg):
+		return segPage
+	case inferPats.slugID.MatchString(seg):
+		return segSlugID
+	case inferPats.slug.MatchString(seg):
+		return segSlug
+	}
+	return segLiteral
+}
+
+// pathSegments splits a url path into its segments (ignoring empty ones)
+func pathSegments(u *url.URL) []string {
+	segs := []string{}
+	for _, seg := range strings.Split(u.Path, "/") {
+		if seg != "" {
+			segs = append(segs, seg)
+		}
+	}
+	return segs
+}
+
+// linkCluster is a set of links with the same path shape
+type linkCluster struct {
+	kinds []int
+	links []*url.URL
+}
+
+// shapeKey returns a key describing the shape of a path
+func shapeKey(kinds []int, segs []string) string {
+	parts := make([]string, len(kinds))
+	for i, kind := range kinds {
+		parts[i] = fmt.Sprintf("%d", kind)
+		if kind == segPage {
+			// keep the file extension
+			parts[i] += inferPats.page.FindString(segs[i])
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// articleScore rates how article-like a cluster is
+func (c *linkCluster) articleScore() float64 {
+	score := 0.0
+	for _, kind := range c.kinds {
+		score += segScores[kind]
+	}
+	if score == 0 {
+		return 0
+	}
+	// favour popular shapes
+	return score * math.Log2(float64(1+len(c.links)))
+}
+
+// pattern builds a regex (to match against RequestURI()) covering the cluster
+func (c *linkCluster) pattern() string {
+	parts := make([]string, len(c.kinds))
+	for i, kind := range c.kinds {
+		if re, ok := segRegexes[kind]; ok {
+			parts[i] = re
+			continue
+		}
+		// literal or page - look at the values we've got
+		vals := map[string]bool{}
+		for _, u := range c.links {
+			vals[pathSegments(u)[i]] = true
+		}
+		if kind == segPage {
+			ext := inferPats.page.FindString(pathSegments(c.links[0])[i])
+			parts[i] = `[^/]+` + regexp.QuoteMeta(ext)
+			continue
+		}
+		if len(vals) > inferPats.maxLiterals {
+			parts[i] = `[^/]+`
+			continue
+		}
+		quoted := []string{}
+		for val, _ := range vals {
+			quoted = append(quoted, regexp.QuoteMeta(val))
+		}
+		sort.Strings(quoted)
+		if len(quoted) == 1 {
+			parts[i] = quoted[0]
+		} else {
+			parts[i] = "(?:" + strings.Join(quoted, "|") + ")"
+		}
+	}
+	return `^/` + strings.Join(parts, "/") + `/?(?:$|\?)`
+}
+
+func examples(links []*url.URL) []string {
+	out := []string{}
+	for _, u := range links {
+		out = append(out, u.String())
+	}
+	sort.Strings(out)
+	if len(out) > inferPats.maxExamples {
+		out = out[:inferPats.maxExamples]
+	}
+	return out
+}
+
+// Infer guesses the ArtPat and NavSel for a site, from a set of its nav pages.
+func Infer(startURL url.URL, pages []Page) *Inference {
+	inf := &Inference{StartURL: startURL, ArtPats: []Candidate{}, NavSels: []Candidate{}}
+
+	// cluster the distinct same-host links by shape
+	seen := map[url.URL]bool{}
+	clusters := map[string]*linkCluster{}
+	keys := []string{}
+	// to find the nav container, we need to know where the links live
+	anchors := map[url.URL][]*html.Node{}
+	for _, page := range pages {
+		for _, a := range aSel.MatchAll(page.Root) {
+			u, err := page.URL.Parse(GetAttr(a, "href"))
+			if err != nil || u.Host != startURL.Host {
+				continue
+			}
+			u.Fragment = ""
+			u.RawQuery = ""
+			anchors[*u] = append(anchors[*u], a)
+			if seen[*u] {
+				continue
+			}
+			seen[*u] = true
+			segs := pathSegments(u)
+			if len(segs) == 0 {
+				continue
+			}
+			kinds := make([]int, len(segs))
+			for i, seg := range segs {
+				kinds[i] = classifySegment(seg)
+			}
+			key := shapeKey(kinds, segs)
+			c, got := clusters[key]
+			if !got {
+				c = &linkCluster{kinds: kinds}
+				clusters[key] = c
+				keys = append(keys, key)
+			}
+			c.links = append(c.links, u)
+		}
+	}
+
+	// article candidates
+	navLinks := []url.URL{}
+	for _, key := range keys {
+		c := clusters[key]
+		score := c.articleScore()
+		if score == 0 {
+			// all literals - could be a section page
+			if len(c.kinds) <= 3 {
+				for _, u := range c.links {
+					navLinks = append(navLinks, *u)
+				}
+			}
+			continue
+		}
+		if len(c.links) < inferPats.minMatches {
+			continue
+		}
+		inf.ArtPats = append(inf.ArtPats, Candidate{
+			Pattern:  c.pattern(),
+			Score:    score,
+			Matches:  len(c.links),
+			Examples: examples(c.links),
+		})
+	}
+	sort.SliceStable(inf.ArtPats, func(i, j int) bool { return inf.ArtPats[i].Score > inf.ArtPats[j].Score })
+
+	// nav candidates - which containers hold the section links?
+	navCands := map[string]map[url.URL]bool{}
+	for _, u := range navLinks {
+		for _, a := range anchors[u] {
+			sel := navContainerSelector(a)
+			if sel == "" {
+				continue
+			}
+			if navCands[sel] == nil {
+				navCands[sel] = map[url.URL]bool{}
+			}
+			navCands[sel][u] = true
+		}
+	}
+	for sel, links := range navCands {
+		if len(links) < inferPats.minMatches {
+			continue
+		}
+		l := []*url.URL{}
+		for u, _ := range links {
+			u := u
+			l = append(l, &u)
+		}
+		inf.NavSels = append(inf.NavSels, Candidate{
+			Pattern:  sel,
+			Score:    float64(len(links)),
+			Matches:  len(links),
+			Examples: examples(l),
+		})
+	}
+	sort.Slice(inf.NavSels, func(i, j int) bool {
+		if inf.NavSels[i].Score == inf.NavSels[j].Score {
+			return inf.NavSels[i].Pattern < inf.NavSels[j].Pattern
+		}
+		return inf.NavSels[i].Score > inf.NavSels[j].Score
+	})
+	return inf
+}
+
+// navContainerSelector returns a selector for the links in the navigation
+// block containing a, or "" if a doesn't seem to be in one.
+func navContainerSelector(a *html.Node) string {
+	for n := a.Parent; n != nil && n.Type == html.ElementNode; n = n.Parent {
+		if n.DataAtom == atom.Body {
+			break
+		}
+		id := GetAttr(n, "id")
+		cls := GetAttr(n, "class")
+		sel := ""
+		switch {
+		case id != "" && inferPats.navClassPat.MatchString(id):
+			sel = "#" + id
+		case inferPats.navClassPat.MatchString(cls):
+			for _, c := range strings.Fields(cls) {
+				if inferPats.navClassPat.MatchString(c) {
+					sel = n.Data + "." + c
+					break
+				}
+			}
+		case n.DataAtom == atom.Nav:
+			sel = "nav"
+		default:
+			continue
+		}
+		sel += " a"
+		if _, err := cascadia.Compile(sel); err != nil {
+			return ""
+		}
+		return sel
+	}
+	return ""
+}
+
+// Def returns a DiscovererDef built from the best candidates, ready for
+// editing. ArtPats scoring at least half the best one are included.
+func (inf *Inference) Def() DiscovererDef {
+	def := DiscovererDef{
+		Name:   inf.StartURL.Host,
+		URL:    inf.StartURL.String(),
+		ArtPat: []string{},
+	}
+	for _, cand := range inf.ArtPats {
+		if cand.Score < inf.ArtPats[0].Score/2 {
+			break
+		}
+		def.ArtPat = append(def.ArtPat, cand.Pattern)
+	}
+	if len(inf.NavSels) > 0 {
+		def.NavSel = inf.NavSels[0].Pattern
+	}
+	return def
+}
+
+// InferFromSite fetches the start page of a site and guesses its link
+// formats. Up to maxPages of the nav pages it finds are also fetched, to
+// give a better sample of links.
+func InferFromSite(ctx context.Context, client *http.Client, startURL string, maxPages int) (*Inference, error) {
+	u, err := url.Parse(startURL)
+	if err != nil {
+		return nil, err
+	}
+	disc := &Discoverer{StartURL: *u, StartURLs: []url.URL{*u}}
+	root, err := disc.fetchAndParse(ctx, client, u)
+	if err != nil {
+		return nil, err
+	}
+	pages := []Page{{URL: *u, Root: root}}
+	inf := Infer(*u, pages)
+	if len(inf.NavSels) == 0 || maxPages <= 0 {
+		return inf, nil
+	}
+
+	disc.NavLinkSel = cascadia.MustCompile(inf.NavSels[0].Pattern)
+	navLinks, _, err := disc.findNavLinks(u, root)
+	if err != nil {
+		return nil, err
+	}
+	delete(navLinks, *u)
+	for len(navLinks) > 0 && len(pages) <= maxPages {
+		navURL := navLinks.Pop()
+		root, err := disc.fetchAndParse(ctx, client, &navURL)
+		if err != nil {
+			// not fatal, we've already got something to work with
+			continue
+		}
+		pages = append(pages, Page{URL: navURL, Root: root})
+	}
+	return Infer(*u, pages), nil
+}
@@ -0,0 +1,191 @@
+package discover
+
+import (
+	"context"
+	"fmt"
+	"golang.org/x/net/html"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestClassifySegment(t *testing.T) {
+	testData := []struct {
+		seg      string
+		expected int
+	}{
+		{"news", segLiteral},
+		{"uk-politics", segLiteral},
+		{"2017", segYear},
+		{"06", segNum},
+		{"8", segNum},
+		{"39483784", segID},
+		{"20170608", segDate},
+		{"2017-06-08", segDate},
+		{"election-night-live", segSlug},
+		{"uk_politics_news", segSlug},
+		{"uk-politics-39483784", segSlugID},
+		{"39483784-election-night", segSlugID},
+		{"a123456", segSlugID},
+		{"story.html", segPage},
+		{"index.php", segPage},
+	}
+	for _, dat := range testData {
+		got := classifySegment(dat.seg)
+		if got != dat.expected {
+			t.Errorf("classifySegment(%q) = %d (expected %d)", dat.seg, got, dat.expected)
+		}
+	}
+}
+
+func TestClusterPattern(t *testing.T) {
+	testData := []struct {
+		kinds    []int
+		paths    []string
+		expected string
+	}{
+		{[]int{segLiteral, segSlugID}, []string{"/news/foo-story-123456", "/news/bar-story-234567"},
+			`^/news/[^/]*\d{4,}[^/]*/?(?:$|\?)`},
+		{[]int{segYear, segNum, segNum, segSlug}, []string{"/2017/06/08/foo-bar-story"},
+			`^/\d{4}/\d{1,4}/\d{1,4}/[^/]*[-_][^/]*[-_][^/]*/?(?:$|\?)`},
+		// a few literals are listed...
+		{[]int{segLiteral, segID}, []string{"/sport/123456", "/news/234567", "/news/345678"},
+			`^/(?:news|sport)/\d{5,}/?(?:$|\?)`},
+		// ...but too many are generalised
+		{[]int{segLiteral, segID}, []string{"/a/123456", "/b/123456", "/c/123456", "/d+e/123456"},
+			`^/[^/]+/\d{5,}/?(?:$|\?)`},
+		{[]int{segLiteral, segPage}, []string{"/news/foo.html", "/news/bar.html"},
+			`^/news/[^/]+\.html/?(?:$|\?)`},
+		{[]int{segLiteral}, []string{"/c++"}, `^/c\+\+/?(?:$|\?)`},
+	}
+	for _, dat := range testData {
+		c := &linkCluster{kinds: dat.kinds}
+		for _, p := range dat.paths {
+			c.links = append(c.links, &url.URL{Scheme: "http", Host: "www.example.com", Path: p})
+		}
+		got := c.pattern()
+		if got != dat.expected {
+			t.Errorf("pattern(%v) = %q (expected %q)", dat.paths, got, dat.expected)
+		}
+		re := regexp.MustCompile(got)
+		for _, p := range dat.paths {
+			if !re.MatchString(p) {
+				t.Errorf("pattern %q doesn't match %s", got, p)
+			}
+		}
+	}
+}
+
+func TestNavClassPat(t *testing.T) {
+	testData := []struct {
+		class    string
+		expected bool
+	}{
+		{"nav", true},
+		{"main-nav", true},
+		{"topnav", true},
+		{"navbar collapse", true},
+		{"site_navigation", true},
+		{"mega-menu", true},
+		{"header", true},
+		{"sections", true},
+		{"topics-list", true},
+		{"canvas", false},
+		{"canvas-wrapper", false},
+		{"navy-blue", false},
+		{"sectional", false},
+		{"headers-and-footers", false},
+	}
+	for _, dat := range testData {
+		got := inferPats.navClassPat.MatchString(dat.class)
+		if got != dat.expected {
+			t.Errorf("navClassPat(%q) = %v (expected %v)", dat.class, got, dat.expected)
+		}
+	}
+}
+
+// inferPage builds a front page with some section links in the nav bar
+// and a couple of different article url formats
+func inferPage(section string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<html><body><header><ul class="main-nav">
+<li><a href="/news">News</a></li><li><a href="/sport">Sport</a></li><li><a href="/politics">Politics</a></li><li><a href="/sport/football">Football</a></li>
+</ul></header><div class="stories">`)
+	for i := 0; i < 6; i++ {
+		fmt.Fprintf(&b, `<a href="/news/%s-story-number-%d-%d">x</a> <a href="/2017/06/%02d/%s-great-story-%d">y</a>`, section, i, 3948000+i, i+1, section, i)
+	}
+	fmt.Fprintf(&b, `</div><footer><a href="/about">about</a><a href="/contact">contact</a><a href="/terms">terms</a></footer></body></html>`)
+	return b.String()
+}
+
+func TestInfer(t *testing.T) {
+	startURL, _ := url.Parse("http://www.example.com/")
+	root, err := html.Parse(strings.NewReader(inferPage("front")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	inf := Infer(*startURL, []Page{{URL: *startURL, Root: root}})
+
+	if len(inf.ArtPats) != 2 {
+		t.Fatalf("got %d ArtPats (expected 2): %+v", len(inf.ArtPats), inf.ArtPats)
+	}
+	arts := []string{"/news/front-story-number-0-3948000", "/2017/06/01/front-great-story-0"}
+	notArts := []string{"/news", "/sport/football", "/about", "/2017/06/01"}
+	def := inf.Def()
+	pats, err := compilePats(def.ArtPat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	matches := func(s string) bool {
+		for _, pat := range pats {
+			if pat.MatchString(s) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, s := range arts {
+		if !matches(s) {
+			t.Errorf("%s not matched by %v", s, def.ArtPat)
+		}
+	}
+	for _, s := range notArts {
+		if matches(s) {
+			t.Errorf("%s matched by %v", s, def.ArtPat)
+		}
+	}
+	if def.NavSel != "ul.main-nav a" {
+		t.Errorf("got NavSel %q (expected %q)", def.NavSel, "ul.main-nav a")
+	}
+}
+
+func TestInferFromSite(t *testing.T) {
+	var fetched int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetched, 1)
+		section := strings.Replace(strings.Trim(r.URL.Path, "/"), "/", "-", -1)
+		if section == "" {
+			section = "front"
+		}
+		fmt.Fprint(w, inferPage(section))
+	}))
+	defer srv.Close()
+
+	inf, err := InferFromSite(context.Background(), srv.Client(), srv.URL+"/", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fetched := atomic.LoadInt32(&fetched); fetched != 3 {
+		t.Errorf("fetched %d pages (expected 3)", fetched)
+	}
+	if len(inf.ArtPats) == 0 || inf.ArtPats[0].Matches != 18 {
+		t.Errorf("bad ArtPats: %+v", inf.ArtPats)
+	}
+	if _, err := regexp.Compile(inf.ArtPats[0].Pattern); err != nil {
+		t.Errorf("bad pattern %q: %s", inf.ArtPats[0].Pattern, err)
+	}
+}
@@ -0,0 +1,126 @@
+package discover
+
+// link.go - article links, along with whatever else the nav page (or feed)
+// told us about them.
+
+import (
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+	"net/url"
+	"regexp"
+)
+
+// Link is an article link found during discovery.
+// Everything except URL and Source is optional.
+type Link struct {
+	URL url.URL
+	// Text is the anchor text (or title, for feeds and sitemaps)
+	Text string
+	// Headline is any heading alongside the link (eg in a story card)
+	Headline string
+	// Source is the nav page, feed or sitemap the link was first found on
+	Source url.URL
+	// Position is where the link appeared on Source (0 = first article link)
+	Position int
+	// DateHint is any date shown alongside the link, or given by the feed
+	// or sitemap, in whatever format the source used.
+	DateHint string
+	// LastMod is the last modification time given by a feed or sitemap
+	LastMod string
+}
+
+// merge fills in any missing details from another sighting of the same link
+func (l *Link) merge(other *Link) {
+	if l.Text == "" {
+		l.Text = other.Text
+	}
+	if l.Headline == "" {
+		l.Headline = other.Headline
+	}
+	if l.DateHint == "" {
+		l.DateHint = other.DateHint
+	}
+	if l.LastMod == "" {
+		l.LastMod = other.LastMod
+	}
+}
+
+// LinkURLs converts a list of Links into a LinkSet
+func LinkURLs(links []*Link) LinkSet {
+	set := make(LinkSet)
+	for _, l := range links {
+		set.Add(l.URL)
+	}
+	return set
+}
+
+var linkPats = struct {
+	headingSel  cascadia.Selector
+	timeSel     cascadia.Selector
+	dateClass   *regexp.Regexp
+	maxCardSize int
+}{
+	cascadia.MustCompile(`h1,h2,h3,h4,h5,h6`),
+	cascadia.MustCompile(`time`),
+	regexp.MustCompile(`(?i)date|time|published|timestamp`),
+	// max number of levels to climb looking for the story card
+	4,
+}
+
+// linkCard returns the largest element around a which holds no other
+// article links (eg the teaser block for a story: headline, image, blurb,
+// timestamp...). artURLs holds the article URL of every article link on
+// the page.
+func linkCard(a *html.Node, artURLs map[*html.Node]*url.URL) *html.Node {
+	u := artURLs[a]
+	card := a
+	n := a.Parent
+	for i := 0; i < linkPats.maxCardSize && n != nil && n.Type == html.ElementNode; i++ {
+		for _, other := range aSel.MatchAll(n) {
+			if otherURL, ok := artURLs[other]; ok && *otherURL != *u {
+				return card
+			}
+		}
+		card = n
+		n = n.Parent
+	}
+	return card
+}
+
+// describeLink fills in whatever details we can find about an article link.
+// artURLs holds the article URL of every article link on the page
+// (including a).
+func (disc *Discoverer) describeLink(pageURL *url.URL, a *html.Node, artURLs map[*html.Node]*url.URL, pos int) *Link {
+	l := &Link{URL: *artURLs[a], Source: *pageURL, Position: pos}
+	l.Text = CompressSpace(GetTextContent(a))
+
+	card := linkCard(a, artURLs)
+	// link inside a heading?
+	for n := a.Parent; n != nil && n != card.Parent; n = n.Parent {
+		if linkPats.headingSel.Match(n) {
+			l.Headline = CompressSpace(GetTextContent(n))
+			break
+		}
+	}
+	if l.Headline == "" {
+		if h := linkPats.headingSel.MatchFirst(card); h != nil {
+			l.Headline = CompressSpace(GetTextContent(h))
+		}
+	}
+
+	// timestamp?
+	if t := linkPats.timeSel.MatchFirst(card); t != nil {
+		l.DateHint = GetAttr(t, "datetime")
+		if l.DateHint == "" {
+			l.DateHint = CompressSpace(GetTextContent(t))
+		}
+	} else {
+		var dateSel cascadia.Selector = func(n *html.Node) bool {
+			return n.Type == html.ElementNode && n != a && linkPats.dateClass.MatchString(GetAttr(n, "class"))
+		}
+		if d := dateSel.MatchFirst(card); d != nil {
+			l.DateHint = CompressSpace(GetTextContent(d))
+		}
+	}
+	return l
+}
@@ -0,0 +1,115 @@
+package discover
+
+import (
+	"golang.org/x/net/html"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestFindArticles(t *testing.T) {
+	src := `<html><body>
+<div class="stories">
+ <div class="card">
+  <a href="/news/one-story"><img src="one.jpg"></a>
+  <h3><a href="/news/one-story">Story one headline</a></h3>
+  <span class="kicker"><a href="/politics">Politics</a></span>
+  <time datetime="2017-06-08T10:00:00Z">2h ago</time>
+ </div>
+ <div class="card">
+  <a href="/news/two-story">Read more</a>
+  <h3>Story two headline</h3>
+  <span class="date">8 June 2017</span>
+ </div>
+ <ul>
+  <li><a href="/news/three-story">Three</a></li>
+  <li><a href="/news/four-story#comments">Four</a></li>
+ </ul>
+</div>
+</body></html>`
+
+	root, err := html.Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	disc, err := NewDiscoverer(DiscovererDef{Name: "test", URL: "http://www.example.com/", ArtPat: []string{`^/news/`}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pageURL, _ := url.Parse("http://www.example.com/")
+	arts, err := disc.findArticles(pageURL, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Link{
+		{Text: "Story one headline", Headline: "Story one headline", Position: 0, DateHint: "2017-06-08T10:00:00Z"},
+		{Text: "Read more", Headline: "Story two headline", Position: 1, DateHint: "8 June 2017"},
+		{Text: "Three", Position: 2},
+		{Text: "Four", Position: 3},
+	}
+	paths := []string{"/news/one-story", "/news/two-story", "/news/three-story", "/news/four-story"}
+	if len(arts) != len(expected) {
+		t.Fatalf("got %d articles (expected %d)", len(arts), len(expected))
+	}
+	for i, l := range arts {
+		exp := expected[i]
+		exp.URL = url.URL{Scheme: "http", Host: "www.example.com", Path: paths[i]}
+		exp.Source = *pageURL
+		if *l != exp {
+			t.Errorf("got %+v (expected %+v)", *l, exp)
+		}
+	}
+}
+
+func TestLinkMerge(t *testing.T) {
+	l := &Link{Text: "Read more", DateHint: "Yesterday"}
+	l.merge(&Link{Text: "Big news", Headline: "Big news", DateHint: "2017-06-08", LastMod: "2017-06-09"})
+	expected := Link{Text: "Read more", Headline: "Big news", DateHint: "Yesterday", LastMod: "2017-06-09"}
+	if *l != expected {
+		t.Errorf("got %+v (expected %+v)", *l, expected)
+	}
+}
+
+func TestCookArticleURL(t *testing.T) {
+	disc, err := NewDiscoverer(DiscovererDef{
+		Name:            "test",
+		URL:             "http://www.example.com/",
+		ArtPat:          []string{`^/news/[^/]+$`},
+		FoldAMP:         true,
+		FoldMobileHosts: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, _ := url.Parse("http://www.example.com/")
+	testData := []struct {
+		link     string
+		expected string // "" for rejected
+	}{
+		{"/news/foo-story?utm_source=x#top", "http://www.example.com/news/foo-story"},
+		// canonicalised before the host and ArtPat checks
+		{"http://m.example.com/news/foo-story", "http://www.example.com/news/foo-story"},
+		{"/news/foo-story/amp", "http://www.example.com/news/foo-story"},
+		{"https://www-example-com.cdn.ampproject.org/c/s/www.example.com/news/foo-story", "https://www.example.com/news/foo-story"},
+		{"http://m.elsewhere.com/news/foo-story", ""},
+		{"/sport/foo-story", ""},
+	}
+	for _, dat := range testData {
+		got := ""
+		u, err := disc.CookArticleURL(base, dat.link)
+		if err == nil {
+			got = u.String()
+		}
+		if got != dat.expected {
+			t.Errorf("CookArticleURL(%s) = %q (expected %q)", dat.link, got, dat.expected)
+		}
+	}
+
+	// the old StripQuery field still works
+	disc.StripQuery = false
+	u, err := disc.CookArticleURL(base, "/news/foo-story?id=42")
+	if err != nil || u.String() != "http://www.example.com/news/foo-story?id=42" {
+		t.Errorf("StripQuery=false: got %v, %v", u, err)
+	}
+}
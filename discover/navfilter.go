@@ -0,0 +1,103 @@
+package discover
+
+// navfilter.go - weeding out nav links we don't want to follow.
+//
+// Lots of sites have huge numbers of tag, author, search and archive pages
+// (eg "mirror.co.uk/all-about/fred-bloggs"). They'll mostly just link to
+// the same articles as the section pages, so following them is a waste of
+// time.
+// The automatic filter is a guess, so it's off unless NavFilter is set.
+
+import (
+	"net/url"
+	"regexp"
+)
+
+// SkipReason describes why a nav link wasn't followed
+type SkipReason int
+
+const (
+	// SkipHost - not on a host we accept
+	SkipHost SkipReason = iota
+	// SkipNotIncluded - didn't match any NavInclude patterns
+	SkipNotIncluded
+	// SkipExcluded - matched a NavExclude pattern
+	SkipExcluded
+	// SkipTag - looks like a tag/topic page
+	SkipTag
+	// SkipAuthor - looks like an author page
+	SkipAuthor
+	// SkipSearch - looks like a search results page
+	SkipSearch
+	// SkipPagination - looks like page 2+ of a listing
+	SkipPagination
+	// SkipArchive - looks like a date-based archive page
+	SkipArchive
+)
+
+func (r SkipReason) String() string {
+	switch r {
+	case SkipHost:
+		return "host rejected"
+	case SkipNotIncluded:
+		return "not included"
+	case SkipExcluded:
+		return "excluded"
+	case SkipTag:
+		return "tag page"
+	case SkipAuthor:
+		return "author page"
+	case SkipSearch:
+		return "search page"
+	case SkipPagination:
+		return "paginated page"
+	case SkipArchive:
+		return "archive page"
+	}
+	return "unknown"
+}
+
+var navFilterPats = []struct {
+	reason SkipReason
+	pat    *regexp.Regexp
+}{
+	{SkipTag, regexp.MustCompile(`(?i)/(?:tags?|tagged|topics?|all-about|subjects?|keywords?|themen|thema|etiquetas?|sujets?)(?:/|$)`)},
+	{SkipAuthor, regexp.MustCompile(`(?i)/(?:authors?|by|profiles?|people|writers?|columnists?|contributors?|journalists?|autor|auteur)(?:/|$)`)},
+	{SkipSearch, regexp.MustCompile(`(?i)/search(?:/|$|\?|\.)|[?&](?:q|s|query|search|keywords?)=`)},
+	// (page 1 is just the listing itself, and ?p=123 is a wordpress post)
+	{SkipPagination, regexp.MustCompile(`(?i)/(?:page|p|seite|pagina)/?0*(?:[2-9]|[1-9]\d+)/?(?:$|\?)|[?&](?:page|pg|pagenum|start|offset)=0*(?:[2-9]|[1-9]\d+)(?:&|$)`)},
+	{SkipArchive, regexp.MustCompile(`(?i)/archives?(?:/|$)|^/(?:19|20)\d\d(?:/\d\d?){0,2}/?(?:$|\?)`)},
+}
+
+// checkNavLink decides if a nav link should be followed.
+// Returns the reason if not.
+// The checks are, in order: host, NavExclude, NavInclude and then (if
+// turned on, and there's no NavInclude) the automatic filter.
+func (disc *Discoverer) checkNavLink(link *url.URL) (SkipReason, bool) {
+	if !disc.isHostGood(link.Host) {
+		return SkipHost, false
+	}
+	foo := link.RequestURI()
+	for _, pat := range disc.NavExclude {
+		if pat.MatchString(foo) {
+			return SkipExcluded, false
+		}
+	}
+	if len(disc.NavInclude) > 0 {
+		// explicitly-included links bypass the automatic filter
+		for _, pat := range disc.NavInclude {
+			if pat.MatchString(foo) {
+				return 0, true
+			}
+		}
+		return SkipNotIncluded, false
+	}
+	if disc.NavFilter {
+		for _, filt := range navFilterPats {
+			if filt.pat.MatchString(foo) {
+				return filt.reason, false
+			}
+		}
+	}
+	return 0, true
+}
@@ -0,0 +1,65 @@
+package discover
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestCheckNavLink(t *testing.T) {
+	testData := []struct {
+		def    DiscovererDef
+		link   string
+		ok     bool
+		reason SkipReason
+	}{
+		{DiscovererDef{}, "/politics", true, 0},
+		{DiscovererDef{}, "http://elsewhere.com/politics", false, SkipHost},
+		// automatic filter is off by default
+		{DiscovererDef{}, "/all-about/fred-bloggs", true, 0},
+		{DiscovererDef{NavFilter: true}, "/politics", true, 0},
+		{DiscovererDef{NavFilter: true}, "/all-about/fred-bloggs", false, SkipTag},
+		{DiscovererDef{NavFilter: true}, "/topics/brexit", false, SkipTag},
+		{DiscovererDef{NavFilter: true}, "/profile/jane-smith", false, SkipAuthor},
+		{DiscovererDef{NavFilter: true}, "/search?q=foo", false, SkipSearch},
+		{DiscovererDef{NavFilter: true}, "/politics?q=foo", false, SkipSearch},
+		{DiscovererDef{NavFilter: true}, "/politics?page=2", false, SkipPagination},
+		{DiscovererDef{NavFilter: true}, "/politics?page=0", true, 0},
+		{DiscovererDef{NavFilter: true}, "/politics/page/3", false, SkipPagination},
+		{DiscovererDef{NavFilter: true}, "/politics?page=10", false, SkipPagination},
+		{DiscovererDef{NavFilter: true}, "/politics?page=1", true, 0},
+		{DiscovererDef{NavFilter: true}, "/politics/page/1", true, 0},
+		{DiscovererDef{NavFilter: true}, "/?p=123", true, 0},
+		{DiscovererDef{NavFilter: true}, "/2017/06/", false, SkipArchive},
+		{DiscovererDef{NavFilter: true}, "/archive/politics", false, SkipArchive},
+		// not fooled by words which just start the same
+		{DiscovererDef{NavFilter: true}, "/tagliatelle-recipes", true, 0},
+		{DiscovererDef{NavFilter: true}, "/bypass", true, 0},
+		{DiscovererDef{NavExclude: []string{`^/promo`}}, "/promotions", false, SkipExcluded},
+		{DiscovererDef{NavExclude: []string{`^/promo`}}, "/politics", true, 0},
+		{DiscovererDef{NavInclude: []string{`^/(?:politics|sport)`}}, "/politics", true, 0},
+		{DiscovererDef{NavInclude: []string{`^/(?:politics|sport)`}}, "/business", false, SkipNotIncluded},
+		// included links bypass the automatic filter...
+		{DiscovererDef{NavFilter: true, NavInclude: []string{`^/(?:politics|sport)`}}, "/sport/page/2", true, 0},
+		// ...but not NavExclude
+		{DiscovererDef{NavInclude: []string{`^/(?:politics|sport)`}, NavExclude: []string{`/live$`}}, "/sport/live", false, SkipExcluded},
+		{DiscovererDef{NavInclude: []string{`^/(?:politics|sport)`}, NavExclude: []string{`/live$`}}, "/sport/football", true, 0},
+	}
+
+	base, _ := url.Parse("http://www.example.com/")
+	for _, dat := range testData {
+		def := dat.def
+		def.URL = base.String()
+		disc, err := NewDiscoverer(def)
+		if err != nil {
+			t.Fatal(err)
+		}
+		link, err := base.Parse(dat.link)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reason, ok := disc.checkNavLink(link)
+		if ok != dat.ok || (!ok && reason != dat.reason) {
+			t.Errorf("%+v: checkNavLink(%s) = %s,%v (expected %s,%v)", dat.def, dat.link, reason, ok, dat.reason, dat.ok)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package discover
+
+// state.go - remembering things between runs, so a Discoverer can:
+//   - return only articles it hasn't seen before
+//   - use conditional GETs (ETag/Last-Modified) to skip unchanged pages
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// PageState is what we remember about a fetched page (nav page, feed,
+// sitemap...). The links are kept so that the crawl can continue past pages
+// which haven't changed since last time.
+type PageState struct {
+	ETag         string   `json:"etag,omitempty"`
+	LastModified string   `json:"last_modified,omitempty"`
+	NavLinks     []string `json:"nav_links,omitempty"`
+	Feeds        []string `json:"feeds,omitempty"`
+	Sitemaps     []string `json:"sitemaps,omitempty"`
+}
+
+// StateStore persists discovery state between runs.
+// It is only accessed by the goroutine calling Run(), so implementations
+// don't need to worry about locking.
+type StateStore interface {
+	// SeenArticle returns true if the article url was found on a previous run
+	SeenArticle(u url.URL) bool
+	// AddArticle records an article url as seen
+	AddArticle(u url.URL)
+	// Page returns the stored state for a page, if any
+	Page(u url.URL) (PageState, bool)
+	// SetPage stores the state for a page
+	SetPage(u url.URL, ps PageState)
+	// Commit persists any changes. Called at the end of every successful
+	// Run.
+	Commit() error
+}
+
+// FileStore is a StateStore which keeps everything in memory and saves it
+// out to a json file.
+type FileStore struct {
+	filename string
+	dirty    bool
+	data     struct {
+		// article urls, with the time they were first seen
+		Articles map[string]time.Time `json:"articles"`
+		Pages    map[string]PageState `json:"pages"`
+	}
+}
+
+// OpenFileStore loads a FileStore from a file. If the file doesn't exist,
+// it'll be created on Commit().
+func OpenFileStore(filename string) (*FileStore, error) {
+	store := &FileStore{filename: filename}
+	store.data.Articles = map[string]time.Time{}
+	store.data.Pages = map[string]PageState{}
+
+	raw, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(raw, &store.data)
+	if err != nil {
+		return nil, err
+	}
+	if store.data.Articles == nil {
+		store.data.Articles = map[string]time.Time{}
+	}
+	if store.data.Pages == nil {
+		store.data.Pages = map[string]PageState{}
+	}
+	return store, nil
+}
+
+func (store *FileStore) SeenArticle(u url.URL) bool {
+	_, got := store.data.Articles[u.String()]
+	return got
+}
+
+func (store *FileStore) AddArticle(u url.URL) {
+	store.data.Articles[u.String()] = time.Now().UTC()
+	store.dirty = true
+}
+
+func (store *FileStore) Page(u url.URL) (PageState, bool) {
+	ps, got := store.data.Pages[u.String()]
+	return ps, got
+}
+
+func (store *FileStore) SetPage(u url.URL, ps PageState) {
+	store.data.Pages[u.String()] = ps
+	store.dirty = true
+}
+
+// Expire forgets articles first seen before a given time, to stop the
+// file growing forever. Returns the number of articles removed.
+func (store *FileStore) Expire(before time.Time) int {
+	cnt := 0
+	for u, t := range store.data.Articles {
+		if t.Before(before) {
+			delete(store.data.Articles, u)
+			cnt++
+		}
+	}
+	if cnt > 0 {
+		store.dirty = true
+	}
+	return cnt
+}
+
+// Commit writes the state out to the file (if anything has changed).
+// A temp file is used, so a failed write won't clobber the previous state.
+func (store *FileStore) Commit() error {
+	if !store.dirty {
+		return nil
+	}
+	raw, err := json.Marshal(&store.data)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(store.filename), filepath.Base(store.filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(raw)
+	if err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), store.filename)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	store.dirty = false
+	return nil
+}
+
+// urlStrings converts urls to strings, for storing
+func urlStrings(urls []url.URL) []string {
+	out := make([]string, len(urls))
+	for i, u := range urls {
+		out[i] = u.String()
+	}
+	return out
+}
+
+// parseURLs is the reverse of urlStrings. Any bad urls are skipped.
+func parseURLs(strs []string) []url.URL {
+	out := make([]url.URL, 0, len(strs))
+	for _, s := range strs {
+		u, err := url.Parse(s)
+		if err != nil {
+			continue
+		}
+		out = append(out, *u)
+	}
+	return out
+}
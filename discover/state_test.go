@@ -0,0 +1,180 @@
+package discover
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "discover")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "state.json")
+
+	store, err := OpenFileStore(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	art, _ := url.Parse("http://www.example.com/news/a-story")
+	page, _ := url.Parse("http://www.example.com/politics")
+	if store.SeenArticle(*art) {
+		t.Errorf("new store has seen %s", art)
+	}
+	store.AddArticle(*art)
+	ps := PageState{ETag: `"v1"`, NavLinks: []string{"http://www.example.com/sport"}}
+	store.SetPage(*page, ps)
+	if err := store.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// read it back
+	store, err = OpenFileStore(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !store.SeenArticle(*art) {
+		t.Errorf("lost %s", art)
+	}
+	got, ok := store.Page(*page)
+	if !ok || got.ETag != ps.ETag || len(got.NavLinks) != 1 || got.NavLinks[0] != ps.NavLinks[0] {
+		t.Errorf("got page state %+v (expected %+v)", got, ps)
+	}
+
+	if n := store.Expire(time.Now().Add(-time.Hour)); n != 0 {
+		t.Errorf("expired %d articles too early", n)
+	}
+	if n := store.Expire(time.Now().Add(time.Hour)); n != 1 {
+		t.Errorf("expired %d articles (expected 1)", n)
+	}
+	if store.SeenArticle(*art) {
+		t.Errorf("%s not expired", art)
+	}
+}
+
+func TestConditionalGet(t *testing.T) {
+	var changed int32 // set for the last run
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		etag := `"v1"`
+		if atomic.LoadInt32(&changed) != 0 && r.URL.Path == "/sec2" {
+			etag = `"v2"`
+		}
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		fmt.Fprintf(w, `<nav><a href="/sec1">1</a><a href="/sec2">2</a></nav><a href="/news/%s-story">x</a>`, r.URL.Path[1:])
+		if etag == `"v2"` {
+			fmt.Fprintf(w, `<a href="/news/extra-story">x</a>`)
+		}
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "discover")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "state.json")
+
+	testData := []struct {
+		changed     int32
+		arts        []string
+		notModified int
+	}{
+		{0, []string{"/news/-story", "/news/sec1-story", "/news/sec2-story"}, 0},
+		// nothing new, but the crawl still gets past the unchanged front page
+		{0, []string{}, 3},
+		{1, []string{"/news/extra-story"}, 2},
+	}
+	for i, dat := range testData {
+		atomic.StoreInt32(&changed, dat.changed)
+		store, err := OpenFileStore(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		disc, err := NewDiscoverer(DiscovererDef{Name: "test", URL: srv.URL + "/", ArtPat: []string{`^/news/`}, NavSel: "nav a"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		disc.State = store
+		arts, err := disc.Run(srv.Client())
+		if err != nil {
+			t.Fatalf("run %d: %s", i, err)
+		}
+		checkPaths(t, fmt.Sprintf("run %d", i), arts, dat.arts)
+		if disc.Stats.FetchCount != 3 || disc.Stats.NotModifiedCount != dat.notModified || disc.Stats.NewCount != len(dat.arts) {
+			t.Errorf("run %d: bad stats %+v", i, disc.Stats)
+		}
+	}
+}
+
+func TestFailedRunState(t *testing.T) {
+	var broken int32 = 1
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" && atomic.LoadInt32(&broken) != 0 {
+			http.Error(w, "nope", 500)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprintf(w, `<nav><a href="/s1">s1</a><a href="/s2">s2</a></nav><a href="/news/a-story">a</a>`)
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "discover")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "state.json")
+	store, err := OpenFileStore(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run := func() ([]*Link, error) {
+		disc, err := NewDiscoverer(DiscovererDef{Name: "test", URL: srv.URL + "/", ArtPat: []string{`^/news/`}, NavSel: "nav a"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		disc.State = store
+		return disc.Run(srv.Client())
+	}
+
+	// a failed run shouldn't touch the state...
+	if _, err := run(); err == nil {
+		t.Fatal("expected an error")
+	}
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		t.Errorf("state committed after a failed run")
+	}
+	art, _ := url.Parse(srv.URL + "/news/a-story")
+	front, _ := url.Parse(srv.URL + "/")
+	if store.SeenArticle(*art) {
+		t.Errorf("%s marked as seen after a failed run", art)
+	}
+	if _, got := store.Page(*front); got {
+		t.Errorf("front page state stored after a failed run")
+	}
+
+	// ...so the next one still finds the article
+	atomic.StoreInt32(&broken, 0)
+	arts, err := run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPaths(t, "second run", arts, []string{"/news/a-story"})
+	if _, err := os.Stat(filename); err != nil {
+		t.Errorf("state not committed: %s", err)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+// commandline tool to help set up article discovery for a site
+//
+// usage:
+//   discovertool infer http://example.com/
+//   discovertool infer -base http://example.com/ saved/*.html
+//
+// infer guesses the article link format (ArtPat) and nav links (NavSel)
+// and outputs a DiscovererDef (yaml) ready for editing.
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/bcampbell/arts/discover"
+	"golang.org/x/net/html"
+	"gopkg.in/yaml.v2"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// ugh. yaml-friendly version of discover.DiscovererDef
+type defYAML struct {
+	Name   string   `yaml:"name"`
+	URL    string   `yaml:"url"`
+	ArtPat []string `yaml:"artpat"`
+	NavSel string   `yaml:"navsel,omitempty"`
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s infer [flags] <start url> | <saved nav pages...>\n", os.Args[0])
+	os.Exit(1)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	switch os.Args[1] {
+	case "infer":
+		err := doInfer(os.Args[2:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %s\n", err)
+			os.Exit(1)
+		}
+	default:
+		usage()
+	}
+}
+
+func doInfer(args []string) error {
+	flags := flag.NewFlagSet("infer", flag.ExitOnError)
+	var baseURL string
+	var maxPages int
+	flags.StringVar(&baseURL, "base", "", "url of the site (required for saved nav pages)")
+	flags.IntVar(&maxPages, "pages", 5, "max number of extra nav pages to fetch")
+	flags.Parse(args)
+
+	if flags.NArg() < 1 {
+		usage()
+	}
+
+	var inf *discover.Inference
+	if baseURL == "" {
+		// fetch the site
+		if flags.NArg() != 1 {
+			usage()
+		}
+		var err error
+		inf, err = discover.InferFromSite(context.Background(), &http.Client{}, flags.Arg(0), maxPages)
+		if err != nil {
+			return err
+		}
+	} else {
+		// use saved pages
+		u, err := url.Parse(baseURL)
+		if err != nil {
+			return err
+		}
+		pages := []discover.Page{}
+		for _, filename := range flags.Args() {
+			root, err := parseFile(filename)
+			if err != nil {
+				return err
+			}
+			pages = append(pages, discover.Page{URL: *u, Root: root})
+		}
+		inf = discover.Infer(*u, pages)
+	}
+
+	return dumpInference(os.Stdout, inf)
+}
+
+func parseFile(filename string) (*html.Node, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return html.Parse(f)
+}
+
+// dumpInference writes out the DiscovererDef, with all the candidates
+// listed in comments.
+func dumpInference(w io.Writer, inf *discover.Inference) error {
+	fmt.Fprintf(w, "# ArtPat candidates:\n")
+	for _, cand := range inf.ArtPats {
+		dumpCandidate(w, cand)
+	}
+	fmt.Fprintf(w, "# NavSel candidates:\n")
+	for _, cand := range inf.NavSels {
+		dumpCandidate(w, cand)
+	}
+
+	def := inf.Def()
+	out, err := yaml.Marshal(&defYAML{
+		Name:   def.Name,
+		URL:    def.URL,
+		ArtPat: def.ArtPat,
+		NavSel: def.NavSel,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+func dumpCandidate(w io.Writer, cand discover.Candidate) {
+	fmt.Fprintf(w, "#   %s  (score %.3g, %d matches)\n", cand.Pattern, cand.Score, cand.Matches)
+	for _, ex := range cand.Examples {
+		fmt.Fprintf(w, "#       %s\n", ex)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+// "scrapetool diff" - extract two captures of the same article and show
+// what changed between them.
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/bcampbell/arts/arts"
+	"os"
+)
+
+func doDiff(args []string) error {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	var asJSON bool
+	var policy string
+	var opts arts.Options
+	flags.BoolVar(&asJSON, "json", false, "output a structured change report (json) instead of a unified diff")
+	flags.StringVar(&policy, "policy", "default", "which elements to keep in the content (default, text or rich)")
+	flags.BoolVar(&opts.StripCaptions, "nocaptions", false, "strip image captions and credits from content")
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		fmt.Fprintf(os.Stderr, "Usage: %s diff [flags] <old> <new>\n", os.Args[0])
+		os.Exit(1)
+	}
+
+	var err error
+	opts.Policy, err = parsePolicy(policy)
+	if err != nil {
+		return err
+	}
+	opts.Blocks = true
+
+	oldArt, err := extractSource(flags.Arg(0), &opts)
+	if err != nil {
+		return err
+	}
+	newArt, err := extractSource(flags.Arg(1), &opts)
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(arts.DiffArticles(oldArt, newArt))
+	}
+	fmt.Print(arts.UnifiedDiff(oldArt, newArt, flags.Arg(0), flags.Arg(1)))
+	return nil
+}
+
+// extractSource loads and extracts an article from a url or file
+func extractSource(srcName string, opts *arts.Options) (*arts.Article, error) {
+	rawHTML, artURL, err := loadSource(srcName)
+	if err != nil {
+		return nil, err
+	}
+	root, err := arts.ParseHTML(rawHTML)
+	if err != nil {
+		return nil, fmt.Errorf("%s: html parsing failed: %s", srcName, err)
+	}
+	art, err := arts.ExtractFromTreeWithOptions(root, artURL, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%s: extraction failed: %s", srcName, err)
+	}
+	return art, nil
+}
@@ -15,14 +15,23 @@ type frontmatterArt struct {
 	// all known URLs for article (including canonical)
 	// TODO: first url should be considered "preferred" if no canonical?
 	URLs     []string            `yaml:"urls,omitempty"`
+	AMPURL   string              `yaml:"amp_url,omitempty"`
 	Headline string              `yaml:"headline,omitempty"`
 	Authors  []frontmatterAuthor `yaml:"authors,omitempty"`
 	//	Content  string   `json:"content,omitempty"`
+	ContentPass string                 `yaml:"content_pass,omitempty"`
+	Images      []frontmatterImage     `yaml:"images,omitempty"`
+	Links       []frontmatterLink      `yaml:"links,omitempty"`
+	Blocks      []frontmatterBlock     `yaml:"blocks,omitempty"`
+	Quotes      []frontmatterQuote     `yaml:"quotes,omitempty"`
+	Entities    []frontmatterEntity    `yaml:"entities,omitempty"`
 	Published   string                 `yaml:"published,omitempty"`
 	Updated     string                 `yaml:"updated,omitempty"`
 	Publication frontmatterPublication `yaml:"publication,omitempty"`
 	Keywords    []frontmatterKeyword   `yaml:"keywords,omitempty"`
 	Section     string                 `yaml:"section,omitempty"`
+	LiveEntries []frontmatterLiveEntry `yaml:"live_entries,omitempty"`
+	Comments    []frontmatterComment   `yaml:"comments,omitempty"`
 	// TODO:
 	// Language
 	// article confidence?
@@ -35,6 +44,60 @@ type frontmatterAuthor struct {
 	Twitter string `yaml:"twitter,omitempty"`
 }
 
+type frontmatterImage struct {
+	URL     string `yaml:"url"`
+	Alt     string `yaml:"alt,omitempty"`
+	Caption string `yaml:"caption,omitempty"`
+	Credit  string `yaml:"credit,omitempty"`
+}
+
+type frontmatterLink struct {
+	URL      string `yaml:"url"`
+	Text     string `yaml:"text,omitempty"`
+	External bool   `yaml:"external,omitempty"`
+	Position int    `yaml:"position"`
+}
+
+type frontmatterBlock struct {
+	ID    string `yaml:"id"`
+	Kind  string `yaml:"kind"`
+	Level int    `yaml:"level,omitempty"`
+	Text  string `yaml:"text"`
+}
+
+type frontmatterQuote struct {
+	Speaker  string `yaml:"speaker,omitempty"`
+	Text     string `yaml:"text"`
+	Position int    `yaml:"position"`
+}
+
+type frontmatterEntity struct {
+	Name     string               `yaml:"name"`
+	Kind     string               `yaml:"kind"`
+	Count    int                  `yaml:"count"`
+	Mentions []frontmatterMention `yaml:"mentions,flow"`
+}
+
+type frontmatterMention struct {
+	Position int    `yaml:"position"`
+	Offset   int    `yaml:"offset"`
+	Text     string `yaml:"text"`
+}
+
+type frontmatterLiveEntry struct {
+	Published string              `yaml:"published,omitempty"`
+	Headline  string              `yaml:"headline,omitempty"`
+	Authors   []frontmatterAuthor `yaml:"authors,omitempty"`
+	Content   string              `yaml:"content,omitempty"`
+}
+
+type frontmatterComment struct {
+	Author    string               `yaml:"author,omitempty"`
+	Published string               `yaml:"published,omitempty"`
+	Text      string               `yaml:"text"`
+	Replies   []frontmatterComment `yaml:"replies,omitempty"`
+}
+
 type frontmatterKeyword struct {
 	Name string `yaml:"name"`
 	URL  string `yaml:"url,omitempty"`
@@ -55,15 +118,7 @@ func dumpArt(w io.Writer, art *arts.Article) error {
 		Domain: art.Publication.Domain,
 	}
 
-	authors2 := make([]frontmatterAuthor, len(art.Authors))
-	for i, author := range art.Authors {
-		authors2[i] = frontmatterAuthor{
-			Name:    author.Name,
-			RelLink: author.RelLink,
-			Email:   author.Email,
-			Twitter: author.Twitter,
-		}
-	}
+	authors2 := convertAuthors(art.Authors)
 	kwds2 := make([]frontmatterKeyword, len(art.Keywords))
 	for i, kw := range art.Keywords {
 		kwds2[i] = frontmatterKeyword{
@@ -72,16 +127,88 @@ func dumpArt(w io.Writer, art *arts.Article) error {
 		}
 	}
 
+	images2 := make([]frontmatterImage, len(art.Images))
+	for i, im := range art.Images {
+		images2[i] = frontmatterImage{
+			URL:     im.URL,
+			Alt:     im.Alt,
+			Caption: im.Caption,
+			Credit:  im.Credit,
+		}
+	}
+
+	links2 := make([]frontmatterLink, len(art.Links))
+	for i, l := range art.Links {
+		links2[i] = frontmatterLink{
+			URL:      l.URL,
+			Text:     l.Text,
+			External: l.External,
+			Position: l.Position,
+		}
+	}
+
+	blocks2 := make([]frontmatterBlock, len(art.Blocks))
+	for i, b := range art.Blocks {
+		blocks2[i] = frontmatterBlock{
+			ID:    b.ID,
+			Kind:  string(b.Kind),
+			Level: b.Level,
+			Text:  b.Text,
+		}
+	}
+
+	quotes2 := make([]frontmatterQuote, len(art.Quotes))
+	for i, q := range art.Quotes {
+		quotes2[i] = frontmatterQuote{
+			Speaker:  q.Speaker,
+			Text:     q.Text,
+			Position: q.Position,
+		}
+	}
+
+	entities2 := make([]frontmatterEntity, len(art.Entities))
+	for i, e := range art.Entities {
+		mentions := make([]frontmatterMention, len(e.Mentions))
+		for j, m := range e.Mentions {
+			mentions[j] = frontmatterMention{Position: m.Position, Offset: m.Offset, Text: m.Text}
+		}
+		entities2[i] = frontmatterEntity{
+			Name:     e.Name,
+			Kind:     string(e.Kind),
+			Count:    e.Count,
+			Mentions: mentions,
+		}
+	}
+
+	entries2 := make([]frontmatterLiveEntry, len(art.LiveEntries))
+	for i, e := range art.LiveEntries {
+		entries2[i] = frontmatterLiveEntry{
+			Published: e.Published,
+			Headline:  e.Headline,
+			Authors:   convertAuthors(e.Authors),
+			Content:   e.Content,
+		}
+	}
+
 	art2 := frontmatterArt{
 		CanonicalURL: art.CanonicalURL,
 		URLs:         art.URLs,
+		AMPURL:       art.AMPURL,
 		Headline:     art.Headline,
 		Authors:      authors2,
+		ContentPass:  art.ContentPass,
+		Images:       images2,
+		Links:        links2,
+		Blocks:       blocks2,
+		Quotes:       quotes2,
+		Entities:     entities2,
 		Published:    art.Published,
 		Updated:      art.Updated,
 		Publication:  pub2,
 		Keywords:     kwds2,
 		Section:      art.Section,
+		LiveEntries:  entries2,
+		Comments:     convertComments(art.Comments),
 	}
 
 	out, err := yaml.Marshal(art2)
@@ -98,3 +225,29 @@ func dumpArt(w io.Writer, art *arts.Article) error {
 	fmt.Fprint(w, art.Content)
 	return nil
 }
+
+func convertAuthors(authors []arts.Author) []frontmatterAuthor {
+	out := make([]frontmatterAuthor, len(authors))
+	for i, author := range authors {
+		out[i] = frontmatterAuthor{
+			Name:    author.Name,
+			RelLink: author.RelLink,
+			Email:   author.Email,
+			Twitter: author.Twitter,
+		}
+	}
+	return out
+}
+
+func convertComments(comments []arts.Comment) []frontmatterComment {
+	out := make([]frontmatterComment, len(comments))
+	for i, c := range comments {
+		out[i] = frontmatterComment{
+			Author:    c.Author,
+			Published: c.Published,
+			Text:      c.Text,
+			Replies:   convertComments(c.Replies),
+		}
+	}
+	return out
+}
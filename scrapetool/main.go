@@ -5,6 +5,9 @@ package main
 // can grab article via http or from a file (raw html or the
 // first response in a .warc)
 //
+// "scrapetool diff <old> <new>" compares two captures of the same
+// article, to spot any changes.
+//
 
 import (
 	"bufio"
@@ -14,6 +17,7 @@ import (
 	"flag"
 	"fmt"
 	"github.com/bcampbell/arts/arts"
+	"github.com/bcampbell/arts/util"
 	"github.com/bcampbell/warc"
 	"golang.org/x/net/html"
 	"io"
@@ -28,18 +32,58 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "diff" {
+		err := doDiff(os.Args[2:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	var debug string
 	var parseOnly bool
-	flag.StringVar(&debug, "d", "", "log debug info to stderr (h=headline, c=content, a=authors d=dates u=urls s=cruft all=hcadus)")
+	var policy string
+	var opts arts.Options
+	flag.StringVar(&debug, "d", "", "log debug info to stderr (h=headline, c=content, a=authors d=dates u=urls s=cruft l=liveblog m=comments q=quotes e=entities all=hcaduslmqe)")
 	flag.BoolVar(&parseOnly, "parse", false, "just dump the parsed html and exit")
+	flag.BoolVar(&opts.StripCaptions, "nocaptions", false, "strip image captions and credits from content")
+	flag.StringVar(&policy, "policy", "default", "which elements to keep in the content (default, text or rich)")
+	flag.BoolVar(&opts.Blocks, "blocks", false, "split content into blocks (paragraphs, headings etc)")
+	flag.BoolVar(&opts.Quotes, "quotes", false, "extract quotes from the content")
+	flag.BoolVar(&opts.Entities, "entities", false, "extract people, organisations and places mentioned in the content")
+	var gazetteer string
+	flag.StringVar(&gazetteer, "gazetteer", "", "extra gazetteer file of known entities (for -entities)")
+	flag.BoolVar(&opts.Comments, "comments", false, "extract reader comments")
+	urlRules := util.DefaultCanonicaliser
+	flag.BoolVar(&urlRules.FoldAMP, "foldamp", false, "fold AMP urls into their non-AMP form")
+	flag.BoolVar(&urlRules.FoldMobileHosts, "foldmobile", false, "fold mobile hosts (m.example.com etc) onto www.")
+	flag.BoolVar(&urlRules.StripExtraTracking, "striptracking", false, "also strip the less certain tracking params from urls (ocid, cmp, share etc)")
+	opts.URLRules = &urlRules
 	var cpuprofile = flag.String("cpuprofile", "", "write cpu profile to file")
 	flag.Parse()
 
 	if len(flag.Args()) != 1 {
 		fmt.Println("Usage: ", os.Args[0], "<article url>")
+		fmt.Println("       ", os.Args[0], "diff [-json] <old> <new>")
+		os.Exit(1)
+	}
+
+	var err error
+	opts.Policy, err = parsePolicy(policy)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %s\n", err)
 		os.Exit(1)
 	}
 
+	if gazetteer != "" {
+		opts.Gazetteer, err = loadGazetteer(gazetteer)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
 	if *cpuprofile != "" {
 		f, err := os.Create(*cpuprofile)
 		if err != nil {
@@ -55,7 +99,7 @@ func main() {
 		debug = ""
 	}
 	if debug == "all" {
-		debug = "hcadus"
+		debug = "hcaduslmqe"
 	}
 	for _, flag := range debug {
 		switch flag {
@@ -71,60 +115,23 @@ func main() {
 			arts.Debug.URLLogger = log.New(os.Stderr, "", 0)
 		case 's':
 			arts.Debug.CruftLogger = log.New(os.Stderr, "", 0)
+		case 'l':
+			arts.Debug.LiveBlogLogger = log.New(os.Stderr, "", 0)
+		case 'm':
+			arts.Debug.CommentsLogger = log.New(os.Stderr, "", 0)
+		case 'q':
+			arts.Debug.QuotesLogger = log.New(os.Stderr, "", 0)
+		case 'e':
+			arts.Debug.EntitiesLogger = log.New(os.Stderr, "", 0)
 		}
 	}
 
-	var rawHTML []byte
-	var artURL string
-
-	srcName := flag.Arg(0)
-	u, err := url.Parse(srcName)
+	rawHTML, artURL, err := loadSource(flag.Arg(0))
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "ERROR: %s is not url: %s", srcName, err)
+		fmt.Fprintf(os.Stderr, "ERROR: %s", err)
 		os.Exit(1)
 	}
 
-	var in io.ReadCloser
-	switch strings.ToLower(u.Scheme) {
-	case "http", "https":
-		artURL = srcName
-		in, err = openHttp(srcName)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "ERROR: http fetch failed: %s", err)
-			os.Exit(1)
-		}
-		rawHTML, err = ioutil.ReadAll(in)
-		in.Close()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "ERROR: read failed: %s", err)
-			os.Exit(1)
-		}
-	case "file", "":
-
-		foo := strings.ToLower(u.Path)
-		if strings.HasSuffix(foo, ".warc") || strings.HasSuffix(foo, ".warc.gz") {
-			// it's a warc file
-			rawHTML, artURL, err = fromWARC(u.Path)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "ERROR: warc read failed: %s", err)
-				os.Exit(1)
-			}
-		} else {
-			// treat as plain html file (url will suck)
-			in, err = os.Open(u.Path)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "ERROR: open failed: %s", err)
-				os.Exit(1)
-			}
-			rawHTML, err = ioutil.ReadAll(in)
-			in.Close()
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "ERROR: read failed: %s", err)
-				os.Exit(1)
-			}
-		}
-	}
-
 	root, err := arts.ParseHTML(rawHTML)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "ERROR: html parsing failed: %s", err)
@@ -140,7 +147,7 @@ func main() {
 		os.Exit(0)
 	}
 
-	art, err := arts.ExtractFromTree(root, artURL)
+	art, err := arts.ExtractFromTreeWithOptions(root, artURL, &opts)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "ERROR: extraction failed: %s", err)
 		os.Exit(1)
@@ -153,6 +160,80 @@ func main() {
 	}
 }
 
+// parsePolicy looks up a SanitisePolicy by name
+func parsePolicy(name string) (*arts.SanitisePolicy, error) {
+	switch name {
+	case "default":
+		return arts.DefaultPolicy(), nil
+	case "text":
+		return arts.TextPolicy(), nil
+	case "rich":
+		return arts.RichPolicy(), nil
+	}
+	return nil, fmt.Errorf("unknown policy %q (expected default, text or rich)", name)
+}
+
+// loadGazetteer reads a gazetteer file, adding it to the default one
+func loadGazetteer(filename string) (*arts.Gazetteer, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gaz := arts.DefaultGazetteer.Clone()
+	err = gaz.Load(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+	return gaz, nil
+}
+
+// loadSource grabs the raw html of an article from a url, a .warc file or
+// a plain html file.
+// returns: html, url, err
+func loadSource(srcName string) ([]byte, string, error) {
+	u, err := url.Parse(srcName)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s is not url: %s", srcName, err)
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		in, err := openHttp(srcName)
+		if err != nil {
+			return nil, "", fmt.Errorf("http fetch failed: %s", err)
+		}
+		defer in.Close()
+		rawHTML, err := ioutil.ReadAll(in)
+		if err != nil {
+			return nil, "", fmt.Errorf("read failed: %s", err)
+		}
+		return rawHTML, srcName, nil
+	case "file", "":
+		foo := strings.ToLower(u.Path)
+		if strings.HasSuffix(foo, ".warc") || strings.HasSuffix(foo, ".warc.gz") {
+			// it's a warc file
+			rawHTML, artURL, err := fromWARC(u.Path)
+			if err != nil {
+				return nil, "", fmt.Errorf("warc read failed: %s", err)
+			}
+			return rawHTML, artURL, nil
+		}
+		// treat as plain html file (url will suck)
+		in, err := os.Open(u.Path)
+		if err != nil {
+			return nil, "", fmt.Errorf("open failed: %s", err)
+		}
+		defer in.Close()
+		rawHTML, err := ioutil.ReadAll(in)
+		if err != nil {
+			return nil, "", fmt.Errorf("read failed: %s", err)
+		}
+		return rawHTML, "", nil
+	}
+	return nil, "", fmt.Errorf("unsupported url scheme: %s", u.Scheme)
+}
+
 // fetch html from a WARC file
 // returns: html, url, err
 func fromWARC(filename string) ([]byte, string, error) {
@@ -0,0 +1,269 @@
+package util
+
+// canon.go - URL canonicalisation, so the same article doesn't end up
+// with multiple identities (tracking params, AMP versions, mobile sites,
+// trailing slashes etc).
+
+import (
+	"github.com/PuerkitoBio/purell"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// TrailingSlash is the policy for trailing slashes on paths
+type TrailingSlash int
+
+const (
+	// SlashKeep - leave paths alone
+	SlashKeep TrailingSlash = iota
+	// SlashStrip - remove trailing slashes (except for the root path)
+	SlashStrip
+	// SlashAdd - add a trailing slash (except for paths with a file extension)
+	SlashAdd
+)
+
+// DefaultTrackingParams match the query keys which are unambiguously used
+// for tracking campaigns, clicks and mailing lists.
+var DefaultTrackingParams = []*regexp.Regexp{
+	regexp.MustCompile(`^utm_`),
+	regexp.MustCompile(`^(?:fbclid|gclid|mc_cid|mc_eid)$`),
+}
+
+// ExtraTrackingParams match more query keys which are usually used for
+// tracking, but not always (some sites use "share", "rss" or "cmp" for
+// other things). See Canonicaliser.StripExtraTracking.
+var ExtraTrackingParams = []*regexp.Regexp{
+	regexp.MustCompile(`^(?:dclid|yclid|msclkid|igshid|_ga|_gl)$`),
+	regexp.MustCompile(`^(?i:ocid|cmp|cmpid|icid|ito|mbid|smid|s_cid|at_medium|at_campaign|at_custom\d*)$`),
+	regexp.MustCompile(`^(?:ns_campaign|ns_mchannel|ns_source|ns_linkname|ns_fee|wt\.mc_id|WT\.mc_id|WT\.tsrc)$`),
+	regexp.MustCompile(`^(?:__twitter_impression|ref_src|ref_url|xtor|sr_share|share|rss)$`),
+}
+
+var canonPats = struct {
+	mobileHost *regexp.Regexp
+	ampCache   *regexp.Regexp
+	ampSuffix  *regexp.Regexp
+	ampPrefix  *regexp.Regexp
+	ampExt     *regexp.Regexp
+	ampKey     *regexp.Regexp
+	ampValKey  *regexp.Regexp
+	fileExt    *regexp.Regexp
+}{
+	regexp.MustCompile(`(?i)^(?:m|mobile|amp)\.`),
+	// eg https://www-example-com.cdn.ampproject.org/c/s/www.example.com/news/foo
+	regexp.MustCompile(`(?i)\.cdn\.ampproject\.org$`),
+	// eg /news/foo/amp
+	regexp.MustCompile(`(?i)/amp/?$`),
+	// eg /amp/news/foo
+	regexp.MustCompile(`(?i)^/amp(?:/|$)`),
+	// eg /news/foo.amp.html, /news/foo.amp
+	regexp.MustCompile(`(?i)\.amp(\.html?)?$`),
+	// query keys which mean AMP whatever the value (eg "?amp=1")...
+	regexp.MustCompile(`(?i)^(?:amp|_amp|amp_js_v|amp_gsa)$`),
+	// ...and those which do when the value is "amp" (eg "?outputType=amp")
+	regexp.MustCompile(`(?i)^(?:outputtype|output|format|view|mode|variant)$`),
+	regexp.MustCompile(`\.[a-zA-Z0-9]{2,5}$`),
+}
+
+// Canonicaliser holds a set of rules for tidying up URLs.
+// The zero value just does safe normalisation (lowercase scheme and host,
+// remove default port etc).
+type Canonicaliser struct {
+	// StripFragment removes the #fragment part
+	StripFragment bool
+	// StripQuery removes all the query params, except KeepParams
+	StripQuery bool
+	// StripTracking removes query params matching TrackingParams
+	StripTracking bool
+	// TrackingParams matches query keys to remove. If nil,
+	// DefaultTrackingParams is used.
+	TrackingParams []*regexp.Regexp
+	// StripExtraTracking also removes query params matching
+	// ExtraTrackingParams
+	StripExtraTracking bool
+	// KeepParams are query keys which are always kept (eg an article id)
+	KeepParams []string
+	// FoldAMP turns AMP urls (and AMP cache urls) into the non-AMP form
+	FoldAMP bool
+	// FoldMobileHosts maps m., mobile. and amp. hosts onto www.
+	// (use HostAliases for sites which don't use www)
+	FoldMobileHosts bool
+	// HostAliases maps hosts onto their canonical form
+	// (eg "mobile.example.com" => "example.com")
+	HostAliases map[string]string
+	// TrailingSlash sets the trailing slash policy
+	TrailingSlash TrailingSlash
+}
+
+// DefaultCanonicaliser strips out tracking params, and that's about it.
+var DefaultCanonicaliser = Canonicaliser{StripTracking: true}
+
+// Canonicalise returns a canonical copy of u. u is left untouched.
+func (c *Canonicaliser) Canonicalise(u *url.URL) *url.URL {
+	out := *u
+	if out.User != nil {
+		user := *out.User
+		out.User = &user
+	}
+
+	if c.FoldAMP && canonPats.ampCache.MatchString(out.Host) {
+		// AMP cache - the original url is embedded in the path
+		// eg /c/s/www.example.com/news/foo => https://www.example.com/news/foo
+		//    /c/www.example.com/news/foo => http://www.example.com/news/foo
+		rest := strings.TrimPrefix(out.Path, "/")
+		if strings.HasPrefix(rest, "c/") {
+			rest = rest[2:]
+			scheme := "http"
+			if strings.HasPrefix(rest, "s/") {
+				scheme = "https"
+				rest = rest[2:]
+			}
+			host, path := rest, "/"
+			if i := strings.Index(rest, "/"); i >= 0 {
+				host, path = rest[:i], rest[i:]
+			}
+			if host != "" {
+				out.Scheme = scheme
+				out.Host = host
+				out.Path = path
+				out.RawPath = ""
+			}
+		}
+	}
+
+	host := strings.ToLower(out.Host)
+	if alias, got := c.HostAliases[host]; got {
+		out.Host = alias
+	} else if c.FoldMobileHosts && canonPats.mobileHost.MatchString(host) {
+		out.Host = "www." + canonPats.mobileHost.ReplaceAllString(host, "")
+	}
+
+	if c.FoldAMP {
+		path := out.Path
+		switch {
+		case canonPats.ampSuffix.MatchString(path):
+			path = canonPats.ampSuffix.ReplaceAllString(path, "")
+		case canonPats.ampPrefix.MatchString(path):
+			path = canonPats.ampPrefix.ReplaceAllString(path, "/")
+		case canonPats.ampExt.MatchString(path):
+			path = canonPats.ampExt.ReplaceAllString(path, "$1")
+		}
+		if path == "" {
+			path = "/"
+		}
+		if path != out.Path {
+			out.Path = path
+			out.RawPath = ""
+		}
+	}
+
+	if c.StripFragment {
+		out.Fragment = ""
+	}
+
+	if out.RawQuery != "" && (c.StripQuery || c.StripTracking || c.StripExtraTracking || c.FoldAMP) {
+		out.RawQuery = c.filterQuery(out.RawQuery)
+	}
+
+	switch c.TrailingSlash {
+	case SlashStrip:
+		if len(out.Path) > 1 && strings.HasSuffix(out.Path, "/") {
+			out.Path = strings.TrimRight(out.Path, "/")
+			if out.Path == "" {
+				out.Path = "/"
+			}
+			out.RawPath = ""
+		}
+	case SlashAdd:
+		if !strings.HasSuffix(out.Path, "/") && !canonPats.fileExt.MatchString(out.Path) {
+			out.Path += "/"
+			out.RawPath = ""
+		}
+	}
+
+	norm, err := url.Parse(purell.NormalizeURL(&out, purell.FlagsSafe))
+	if err != nil {
+		return &out
+	}
+	return norm
+}
+
+// CanonicaliseString parses link (relative to baseURL, if set) and returns
+// the canonical form.
+func (c *Canonicaliser) CanonicaliseString(link string, baseURL *url.URL) (string, error) {
+	var u *url.URL
+	var err error
+	if baseURL != nil {
+		u, err = baseURL.Parse(link)
+	} else {
+		u, err = url.Parse(link)
+	}
+	if err != nil {
+		return "", err
+	}
+	return c.Canonicalise(u).String(), nil
+}
+
+// filterQuery removes the unwanted params from a raw query string, keeping
+// the order of the rest.
+func (c *Canonicaliser) filterQuery(rawQuery string) string {
+	trackingParams := c.TrackingParams
+	if trackingParams == nil {
+		trackingParams = DefaultTrackingParams
+	}
+	kept := []string{}
+	for _, param := range strings.Split(rawQuery, "&") {
+		if param == "" {
+			continue
+		}
+		key, val := param, ""
+		if i := strings.Index(param, "="); i >= 0 {
+			key, val = param[:i], param[i+1:]
+		}
+		key, err := url.QueryUnescape(key)
+		if err != nil {
+			kept = append(kept, param)
+			continue
+		}
+		if c.keepParam(key, val, trackingParams) {
+			kept = append(kept, param)
+		}
+	}
+	return strings.Join(kept, "&")
+}
+
+func (c *Canonicaliser) keepParam(key string, val string, trackingParams []*regexp.Regexp) bool {
+	for _, k := range c.KeepParams {
+		if k == key {
+			return true
+		}
+	}
+	if c.StripQuery {
+		return false
+	}
+	if c.FoldAMP {
+		// eg "?amp=1", "?outputType=amp"
+		if canonPats.ampKey.MatchString(key) {
+			return false
+		}
+		if canonPats.ampValKey.MatchString(key) && strings.ToLower(val) == "amp" {
+			return false
+		}
+	}
+	if c.StripTracking {
+		for _, pat := range trackingParams {
+			if pat.MatchString(key) {
+				return false
+			}
+		}
+	}
+	if c.StripExtraTracking {
+		for _, pat := range ExtraTrackingParams {
+			if pat.MatchString(key) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,56 @@
+package util
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestCanonicalise(t *testing.T) {
+	testData := []struct {
+		canon  Canonicaliser
+		in     string
+		expect string
+	}{
+		// safe normalisation only
+		{Canonicaliser{}, "HTTP://Example.COM:80/news/foo?utm_source=x#top", "http://example.com/news/foo?utm_source=x#top"},
+		// tracking params
+		{DefaultCanonicaliser, "http://example.com/news/foo?utm_source=x&id=42&fbclid=abc&mc_cid=1", "http://example.com/news/foo?id=42"},
+		// the less certain ones are only removed if asked
+		{DefaultCanonicaliser, "http://example.com/news/foo?share=1&CMP=share_btn&rss=1", "http://example.com/news/foo?share=1&CMP=share_btn&rss=1"},
+		{Canonicaliser{StripExtraTracking: true}, "http://example.com/news/foo?ocid=socialflow_twitter&share=1&id=42", "http://example.com/news/foo?id=42"},
+		// strip query, but keep the article id
+		{Canonicaliser{StripQuery: true, KeepParams: []string{"id"}}, "http://example.com/story.php?id=42&section=news", "http://example.com/story.php?id=42"},
+		{Canonicaliser{StripFragment: true}, "http://example.com/news/foo#comments", "http://example.com/news/foo"},
+		// AMP
+		{Canonicaliser{FoldAMP: true}, "http://example.com/news/foo/amp", "http://example.com/news/foo"},
+		{Canonicaliser{FoldAMP: true}, "http://example.com/amp/news/foo", "http://example.com/news/foo"},
+		{Canonicaliser{FoldAMP: true}, "http://example.com/news/foo.amp.html", "http://example.com/news/foo.html"},
+		{Canonicaliser{FoldAMP: true}, "http://example.com/news/foo?outputType=amp&id=1", "http://example.com/news/foo?id=1"},
+		{Canonicaliser{FoldAMP: true}, "https://www-example-com.cdn.ampproject.org/c/s/www.example.com/news/foo/amp", "https://www.example.com/news/foo"},
+		{Canonicaliser{FoldAMP: true}, "https://www-example-com.cdn.ampproject.org/c/www.example.com/news/foo.amp.html", "http://www.example.com/news/foo.html"},
+		{Canonicaliser{FoldAMP: true}, "https://www-example-com.cdn.ampproject.org/c/s/www.example.com", "https://www.example.com/"},
+		{Canonicaliser{FoldAMP: true}, "https://www-example-com.cdn.ampproject.org/c/s/www.example.com/", "https://www.example.com/"},
+		{Canonicaliser{FoldAMP: true}, "http://example.com/news/foo?amp&id=1", "http://example.com/news/foo?id=1"},
+		// only known AMP params go
+		{Canonicaliser{FoldAMP: true}, "http://example.com/search?q=amp&section=amp", "http://example.com/search?q=amp&section=amp"},
+		// mobile hosts
+		{Canonicaliser{FoldMobileHosts: true}, "http://m.example.com/news/foo", "http://www.example.com/news/foo"},
+		{Canonicaliser{FoldMobileHosts: true, HostAliases: map[string]string{"m.example.com": "example.com"}}, "http://m.example.com/news/foo", "http://example.com/news/foo"},
+		// trailing slashes
+		{Canonicaliser{TrailingSlash: SlashStrip}, "http://example.com/news/foo/", "http://example.com/news/foo"},
+		{Canonicaliser{TrailingSlash: SlashStrip}, "http://example.com/", "http://example.com/"},
+		{Canonicaliser{TrailingSlash: SlashAdd}, "http://example.com/news/foo", "http://example.com/news/foo/"},
+		{Canonicaliser{TrailingSlash: SlashAdd}, "http://example.com/news/foo.html", "http://example.com/news/foo.html"},
+	}
+
+	for _, dat := range testData {
+		u, err := url.Parse(dat.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := dat.canon.Canonicalise(u).String()
+		if got != dat.expect {
+			t.Errorf("Canonicalise(%s) got %s (expected %s)", dat.in, got, dat.expect)
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package util
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrDisallowed is returned for requests blocked by robots.txt.
+// (http.Client wraps it up in a url.Error - use IsDisallowed() to check)
+var ErrDisallowed = errors.New("disallowed by robots.txt")
+
+// IsDisallowed returns true if err is (or wraps) ErrDisallowed
+func IsDisallowed(err error) bool {
+	if uerr, ok := err.(*url.Error); ok {
+		err = uerr.Err
+	}
+	return err == ErrDisallowed
+}
+
+// RobotsTripper is a http.RoundTripper implementation which obeys
+// robots.txt. It fetches and caches robots.txt for each host, refuses
+// disallowed requests (with ErrDisallowed) and imposes any Crawl-delay.
+// If robots.txt can't be fetched at all (network errors etc), requests to
+// the host fail with that error until RetryTime has passed.
+// It can be chained with PoliteTripper:
+//
+//	c := &http.Client{
+//		Transport: NewRobotsTripper("mybot", NewPoliteTripper()),
+//	}
+type RobotsTripper struct {
+	// UserAgent is used to pick the robots.txt rules which apply to us
+	UserAgent string
+	// Transport does the actual requests (nil means http.DefaultTransport)
+	Transport http.RoundTripper
+	// CacheTime is how long to keep robots.txt for
+	CacheTime time.Duration
+	// RetryTime is how long to wait before refetching a robots.txt which
+	// couldn't be fetched (all requests to the host fail until then)
+	RetryTime time.Duration
+
+	lock  sync.Mutex
+	hosts map[string]*robotsHost
+}
+
+type robotsHost struct {
+	ready     chan struct{} // closed when rules are fetched
+	rules     *robotsRules
+	err       error // set if robots.txt couldn't be fetched
+	cancelled bool  // fetch was cancelled by the requester
+	expires   time.Time
+	prevTime  time.Time // for Crawl-delay
+}
+
+// maxRobotsRedirects is how many redirects to follow when fetching
+// robots.txt (the spec says at least five)
+const maxRobotsRedirects = 5
+
+type robotsRule struct {
+	allow bool
+	pat   *regexp.Regexp
+	size  int // length of the original pattern (longest match wins)
+}
+
+type robotsRules struct {
+	disallowAll bool
+	rules       []robotsRule
+	crawlDelay  time.Duration
+}
+
+func NewRobotsTripper(userAgent string, transport http.RoundTripper) *RobotsTripper {
+	return &RobotsTripper{
+		UserAgent: userAgent,
+		Transport: transport,
+		CacheTime: 24 * time.Hour,
+		RetryTime: 5 * time.Minute,
+		hosts:     make(map[string]*robotsHost),
+	}
+}
+
+func (this *RobotsTripper) transport() http.RoundTripper {
+	if this.Transport != nil {
+		return this.Transport
+	}
+	return http.DefaultTransport
+}
+
+func (this *RobotsTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Path == "/robots.txt" {
+		return this.transport().RoundTrip(req)
+	}
+
+	host := this.getHost(req)
+	if host.err != nil {
+		return nil, host.err
+	}
+	if !host.rules.allowed(req.URL.RequestURI()) {
+		return nil, ErrDisallowed
+	}
+
+	// obey any Crawl-delay
+	for host.rules.crawlDelay > 0 {
+		this.lock.Lock()
+		elapsed := time.Since(host.prevTime)
+		if elapsed >= host.rules.crawlDelay {
+			host.prevTime = time.Now()
+			this.lock.Unlock()
+			break
+		}
+		this.lock.Unlock()
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(host.rules.crawlDelay - elapsed):
+		}
+	}
+
+	return this.transport().RoundTrip(req)
+}
+
+// getHost returns the robots.txt info for the host of the request,
+// fetching it if needed. Concurrent requests to the same host wait for a
+// single fetch.
+func (this *RobotsTripper) getHost(req *http.Request) *robotsHost {
+	key := req.URL.Scheme + "://" + req.URL.Host
+	for {
+		this.lock.Lock()
+		if this.hosts == nil {
+			this.hosts = make(map[string]*robotsHost)
+		}
+		host, got := this.hosts[key]
+		if got {
+			select {
+			case <-host.ready:
+				if !time.Now().Before(host.expires) {
+					got = false
+				}
+			default:
+			}
+		}
+		if !got {
+			prev := host
+			host = &robotsHost{ready: make(chan struct{})}
+			if prev != nil {
+				host.prevTime = prev.prevTime
+			}
+			this.hosts[key] = host
+			this.lock.Unlock()
+
+			rules, cacheTime, err := this.fetchRules(req)
+			host.rules = rules
+			host.err = err
+			host.cancelled = err != nil && req.Context().Err() != nil
+			host.expires = time.Now().Add(cacheTime)
+			close(host.ready)
+			return host
+		}
+		this.lock.Unlock()
+		<-host.ready
+		if host.cancelled && req.Context().Err() == nil {
+			// someone else's request was cancelled - have another go
+			continue
+		}
+		return host
+	}
+}
+
+// fetchRules fetches and parses robots.txt for the host of req, following
+// any redirects.
+// Returns the rules and how long to cache them for, or an error if
+// robots.txt couldn't be fetched (or the request was cancelled).
+func (this *RobotsTripper) fetchRules(req *http.Request) (*robotsRules, time.Duration, error) {
+	robotsURL := &url.URL{Scheme: req.URL.Scheme, Host: req.URL.Host, Path: "/robots.txt"}
+	for redirects := 0; ; redirects++ {
+		robotsReq, err := http.NewRequest("GET", robotsURL.String(), nil)
+		if err != nil {
+			return nil, this.RetryTime, err
+		}
+		robotsReq = robotsReq.WithContext(req.Context())
+		if this.UserAgent != "" {
+			robotsReq.Header.Set("User-Agent", this.UserAgent)
+		}
+		resp, err := this.transport().RoundTrip(robotsReq)
+		if err != nil {
+			if ctxErr := req.Context().Err(); ctxErr != nil {
+				// request was cancelled - not the host's fault
+				return nil, 0, ctxErr
+			}
+			// unreachable - try again soon
+			return nil, this.RetryTime, fmt.Errorf("fetching %s: %s", robotsURL, err)
+		}
+
+		switch {
+		case resp.StatusCode >= 200 && resp.StatusCode < 300:
+			defer resp.Body.Close()
+			return parseRobots(resp.Body, this.UserAgent), this.CacheTime, nil
+		case resp.StatusCode >= 300 && resp.StatusCode < 400:
+			loc := resp.Header.Get("Location")
+			resp.Body.Close()
+			next, err := robotsURL.Parse(loc)
+			if loc == "" || err != nil || redirects >= maxRobotsRedirects {
+				// broken or endless redirects - treat as unavailable
+				return &robotsRules{}, this.CacheTime, nil
+			}
+			robotsURL = next
+			continue
+		case resp.StatusCode >= 400 && resp.StatusCode < 500:
+			// no robots.txt - anything goes
+			resp.Body.Close()
+			return &robotsRules{}, this.CacheTime, nil
+		}
+		// server error - the spec says to assume the worst
+		resp.Body.Close()
+		return &robotsRules{disallowAll: true}, this.RetryTime, nil
+	}
+}
+
+// allowed returns true if the path (and query) can be fetched
+func (rules *robotsRules) allowed(path string) bool {
+	if rules.disallowAll {
+		return false
+	}
+	best := -1
+	allow := true
+	for _, rule := range rules.rules {
+		if rule.size < best || !rule.pat.MatchString(path) {
+			continue
+		}
+		if rule.size > best || rule.allow {
+			// longest match wins (allow wins ties)
+			allow = rule.allow
+		}
+		best = rule.size
+	}
+	return allow
+}
+
+// parseRobots parses a robots.txt, returning the rules which apply to
+// userAgent (or the "*" rules if there aren't any specific to us).
+func parseRobots(r io.Reader, userAgent string) *robotsRules {
+	// use just the product token, eg "mybot" from "mybot/1.0 (+http://...)"
+	agent := strings.ToLower(userAgent)
+	if i := strings.IndexAny(agent, "/ "); i >= 0 {
+		agent = agent[:i]
+	}
+
+	ours := &robotsRules{}
+	wildcard := &robotsRules{}
+	gotOurs := false
+
+	var current []*robotsRules // groups the lines are being applied to
+	inAgents := false          // reading a run of User-agent lines?
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		field := strings.ToLower(strings.TrimSpace(parts[0]))
+		value := strings.TrimSpace(parts[1])
+
+		if field == "user-agent" {
+			if !inAgents {
+				current = nil
+				inAgents = true
+			}
+			ua := strings.ToLower(value)
+			if ua == "*" {
+				current = append(current, wildcard)
+			} else if agent != "" && agent == ua {
+				current = append(current, ours)
+				gotOurs = true
+			}
+			continue
+		}
+		inAgents = false
+
+		for _, rules := range current {
+			switch field {
+			case "allow", "disallow":
+				if value == "" {
+					// empty disallow = allow everything
+					continue
+				}
+				rules.rules = append(rules.rules, robotsRule{
+					allow: field == "allow",
+					pat:   robotsPattern(value),
+					size:  len(value),
+				})
+			case "crawl-delay":
+				secs, err := strconv.ParseFloat(value, 64)
+				if err == nil && secs > 0 {
+					rules.crawlDelay = time.Duration(secs * float64(time.Second))
+				}
+			}
+		}
+	}
+	if gotOurs {
+		return ours
+	}
+	return wildcard
+}
+
+// robotsPattern converts a robots.txt path pattern into a regexp
+// ("*" matches anything, "$" anchors the end)
+func robotsPattern(pat string) *regexp.Regexp {
+	anchored := strings.HasSuffix(pat, "$")
+	pat = strings.TrimSuffix(pat, "$")
+	parts := strings.Split(pat, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	re := "^" + strings.Join(parts, ".*")
+	if anchored {
+		re += "$"
+	}
+	return regexp.MustCompile(re)
+}
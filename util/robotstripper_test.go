@@ -0,0 +1,161 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRobots(t *testing.T) {
+	robotsTxt := `
+# comment
+User-agent: *
+Disallow: /private/
+Allow: /private/public.html
+Disallow: /*.pdf$
+
+User-agent: otherbot
+User-agent: mybot
+Disallow: /news/archive
+Crawl-delay: 2.5
+`
+	testData := []struct {
+		agent  string
+		path   string
+		expect bool
+	}{
+		{"somebot", "/news/foo", true},
+		{"somebot", "/private/foo", false},
+		{"somebot", "/private/public.html", true},
+		{"somebot", "/docs/report.pdf", false},
+		{"somebot", "/docs/report.pdf?x=1", true},
+		{"mybot/1.0", "/private/foo", true},
+		{"mybot/1.0", "/news/archive/2017", false},
+		{"MyBot", "/news/archived", false},
+	}
+	for _, dat := range testData {
+		rules := parseRobots(strings.NewReader(robotsTxt), dat.agent)
+		got := rules.allowed(dat.path)
+		if got != dat.expect {
+			t.Errorf("%s %s: got %v (expected %v)", dat.agent, dat.path, got, dat.expect)
+		}
+	}
+
+	rules := parseRobots(strings.NewReader(robotsTxt), "mybot")
+	if rules.crawlDelay != 2500*time.Millisecond {
+		t.Errorf("bad crawl-delay: %s", rules.crawlDelay)
+	}
+}
+
+func TestRobotsTripper(t *testing.T) {
+	robotsCnt := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		robotsCnt++
+		fmt.Fprintf(w, "User-agent: *\nDisallow: /secret\n")
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "hello")
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	c := &http.Client{Transport: NewRobotsTripper("testbot", nil)}
+	for _, path := range []string{"/", "/news", "/secret/stuff"} {
+		resp, err := c.Get(srv.URL + path)
+		if path == "/secret/stuff" {
+			if !IsDisallowed(err) {
+				t.Errorf("%s: expected ErrDisallowed (got %v)", path, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", path, err)
+			continue
+		}
+		resp.Body.Close()
+	}
+	if robotsCnt != 1 {
+		t.Errorf("robots.txt fetched %d times (expected 1)", robotsCnt)
+	}
+}
+
+func TestRobotsRedirect(t *testing.T) {
+	// eg http => https, or example.com => www.example.com
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			fmt.Fprintf(w, "User-agent: *\nDisallow: /secret\n")
+			return
+		}
+		fmt.Fprintf(w, "hello")
+	}))
+	defer target.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			http.Redirect(w, r, target.URL+"/robots.txt", http.StatusMovedPermanently)
+			return
+		}
+		fmt.Fprintf(w, "hello")
+	}))
+	defer srv.Close()
+
+	c := &http.Client{Transport: NewRobotsTripper("testbot", nil)}
+	resp, err := c.Get(srv.URL + "/news")
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+	resp.Body.Close()
+	if _, err := c.Get(srv.URL + "/secret"); !IsDisallowed(err) {
+		t.Errorf("expected ErrDisallowed (got %v)", err)
+	}
+}
+
+type failingTransport struct{}
+
+func (failingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestRobotsFetchFailed(t *testing.T) {
+	c := &http.Client{Transport: NewRobotsTripper("testbot", failingTransport{})}
+	_, err := c.Get("http://example.com/news")
+	if err == nil || IsDisallowed(err) {
+		t.Errorf("expected fetch error (got %v)", err)
+	}
+}
+
+func TestRobotsCrawlDelayCancel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			fmt.Fprintf(w, "User-agent: *\nCrawl-delay: 10\n")
+			return
+		}
+		fmt.Fprintf(w, "hello")
+	}))
+	defer srv.Close()
+
+	c := &http.Client{Transport: NewRobotsTripper("testbot", nil)}
+	resp, err := c.Get(srv.URL + "/one")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	// the next request has to wait for the crawl-delay
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequest("GET", srv.URL+"/two", nil)
+	start := time.Now()
+	_, err = c.Do(req.WithContext(ctx))
+	if err == nil || IsDisallowed(err) {
+		t.Errorf("expected cancellation (got %v)", err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("waited %s for cancelled request", time.Since(start))
+	}
+}